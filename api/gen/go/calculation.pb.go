@@ -1,218 +0,0 @@
-// Code generated by protoc-gen-go. DO NOT EDIT.
-// versions:
-// 	protoc-gen-go v1.36.6
-// 	protoc        v6.30.2
-// source: calculation.proto
-
-package proto
-
-import (
-	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
-	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
-	reflect "reflect"
-	sync "sync"
-	unsafe "unsafe"
-)
-
-const (
-	// Verify that this generated code is sufficiently up-to-date.
-	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
-	// Verify that runtime/protoimpl is sufficiently up-to-date.
-	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
-)
-
-type TaskRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
-	Arg1          string                 `protobuf:"bytes,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
-	Arg2          string                 `protobuf:"bytes,3,opt,name=arg2,proto3" json:"arg2,omitempty"`
-	Operator      string                 `protobuf:"bytes,4,opt,name=operator,proto3" json:"operator,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
-}
-
-func (x *TaskRequest) Reset() {
-	*x = TaskRequest{}
-	mi := &file_calculation_proto_msgTypes[0]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
-}
-
-func (x *TaskRequest) String() string {
-	return protoimpl.X.MessageStringOf(x)
-}
-
-func (*TaskRequest) ProtoMessage() {}
-
-func (x *TaskRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_calculation_proto_msgTypes[0]
-	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
-	}
-	return mi.MessageOf(x)
-}
-
-// Deprecated: Use TaskRequest.ProtoReflect.Descriptor instead.
-func (*TaskRequest) Descriptor() ([]byte, []int) {
-	return file_calculation_proto_rawDescGZIP(), []int{0}
-}
-
-func (x *TaskRequest) GetId() int32 {
-	if x != nil {
-		return x.Id
-	}
-	return 0
-}
-
-func (x *TaskRequest) GetArg1() string {
-	if x != nil {
-		return x.Arg1
-	}
-	return ""
-}
-
-func (x *TaskRequest) GetArg2() string {
-	if x != nil {
-		return x.Arg2
-	}
-	return ""
-}
-
-func (x *TaskRequest) GetOperator() string {
-	if x != nil {
-		return x.Operator
-	}
-	return ""
-}
-
-type AgentResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
-	Result        float32                `protobuf:"fixed32,2,opt,name=result,proto3" json:"result,omitempty"`
-	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
-}
-
-func (x *AgentResponse) Reset() {
-	*x = AgentResponse{}
-	mi := &file_calculation_proto_msgTypes[1]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
-}
-
-func (x *AgentResponse) String() string {
-	return protoimpl.X.MessageStringOf(x)
-}
-
-func (*AgentResponse) ProtoMessage() {}
-
-func (x *AgentResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_calculation_proto_msgTypes[1]
-	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
-	}
-	return mi.MessageOf(x)
-}
-
-// Deprecated: Use AgentResponse.ProtoReflect.Descriptor instead.
-func (*AgentResponse) Descriptor() ([]byte, []int) {
-	return file_calculation_proto_rawDescGZIP(), []int{1}
-}
-
-func (x *AgentResponse) GetId() int32 {
-	if x != nil {
-		return x.Id
-	}
-	return 0
-}
-
-func (x *AgentResponse) GetResult() float32 {
-	if x != nil {
-		return x.Result
-	}
-	return 0
-}
-
-func (x *AgentResponse) GetError() string {
-	if x != nil {
-		return x.Error
-	}
-	return ""
-}
-
-var File_calculation_proto protoreflect.FileDescriptor
-
-const file_calculation_proto_rawDesc = "" +
-	"\n" +
-	"\x11calculation.proto\x12\tcalculate\"a\n" +
-	"\vTaskRequest\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
-	"\x04arg1\x18\x02 \x01(\tR\x04arg1\x12\x12\n" +
-	"\x04arg2\x18\x03 \x01(\tR\x04arg2\x12\x1a\n" +
-	"\boperator\x18\x04 \x01(\tR\boperator\"M\n" +
-	"\rAgentResponse\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x16\n" +
-	"\x06result\x18\x02 \x01(\x02R\x06result\x12\x14\n" +
-	"\x05error\x18\x03 \x01(\tR\x05error2Q\n" +
-	"\fOrchestrator\x12A\n" +
-	"\tCalculate\x12\x18.calculate.AgentResponse\x1a\x16.calculate.TaskRequest(\x010\x01B#Z!github.com/vedsatt/calc_prl/protob\x06proto3"
-
-var (
-	file_calculation_proto_rawDescOnce sync.Once
-	file_calculation_proto_rawDescData []byte
-)
-
-func file_calculation_proto_rawDescGZIP() []byte {
-	file_calculation_proto_rawDescOnce.Do(func() {
-		file_calculation_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_calculation_proto_rawDesc), len(file_calculation_proto_rawDesc)))
-	})
-	return file_calculation_proto_rawDescData
-}
-
-var file_calculation_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
-var file_calculation_proto_goTypes = []any{
-	(*TaskRequest)(nil),   // 0: calculate.TaskRequest
-	(*AgentResponse)(nil), // 1: calculate.AgentResponse
-}
-var file_calculation_proto_depIdxs = []int32{
-	1, // 0: calculate.Orchestrator.Calculate:input_type -> calculate.AgentResponse
-	0, // 1: calculate.Orchestrator.Calculate:output_type -> calculate.TaskRequest
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
-}
-
-func init() { file_calculation_proto_init() }
-func file_calculation_proto_init() {
-	if File_calculation_proto != nil {
-		return
-	}
-	type x struct{}
-	out := protoimpl.TypeBuilder{
-		File: protoimpl.DescBuilder{
-			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
-			RawDescriptor: unsafe.Slice(unsafe.StringData(file_calculation_proto_rawDesc), len(file_calculation_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   2,
-			NumExtensions: 0,
-			NumServices:   1,
-		},
-		GoTypes:           file_calculation_proto_goTypes,
-		DependencyIndexes: file_calculation_proto_depIdxs,
-		MessageInfos:      file_calculation_proto_msgTypes,
-	}.Build()
-	File_calculation_proto = out.File
-	file_calculation_proto_goTypes = nil
-	file_calculation_proto_depIdxs = nil
-}
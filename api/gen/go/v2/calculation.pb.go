@@ -0,0 +1,302 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v6.30.2
+// source: v2/calculation.proto
+
+// v2: результат - double, а не float; v1 терял точность уже на седьмом знаке
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type TaskRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Arg1          string                 `protobuf:"bytes,2,opt,name=arg1,proto3" json:"arg1,omitempty"`
+	Arg2          string                 `protobuf:"bytes,3,opt,name=arg2,proto3" json:"arg2,omitempty"`
+	Operator      string                 `protobuf:"bytes,4,opt,name=operator,proto3" json:"operator,omitempty"`
+	Args          []string               `protobuf:"bytes,5,rep,name=args,proto3" json:"args,omitempty"`                                      // аргументы функции, для операторов используются arg1 и arg2
+	ExpressionId  int32                  `protobuf:"varint,6,opt,name=expression_id,json=expressionId,proto3" json:"expression_id,omitempty"` // id узла уникален только в пределах выражения
+	Mode          string                 `protobuf:"bytes,7,opt,name=mode,proto3" json:"mode,omitempty"`                                      // режим чисел: "" или "float", "decimal", "rational"
+	Scale         int32                  `protobuf:"varint,8,opt,name=scale,proto3" json:"scale,omitempty"`                                   // знаков после запятой в режиме decimal
+	Rounding      string                 `protobuf:"bytes,9,opt,name=rounding,proto3" json:"rounding,omitempty"`                              // способ округления в режиме decimal
+	Cancel        bool                   `protobuf:"varint,10,opt,name=cancel,proto3" json:"cancel,omitempty"`                                // выражение отменено: агент бросает его еще не начатые задачи, остальные поля пусты
+	BudgetMs      int64                  `protobuf:"varint,11,opt,name=budget_ms,json=budgetMs,proto3" json:"budget_ms,omitempty"`            // сколько мс осталось до срока выражения на момент отправки, 0 - срока нет
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TaskRequest) Reset() {
+	*x = TaskRequest{}
+	mi := &file_v2_calculation_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TaskRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TaskRequest) ProtoMessage() {}
+
+func (x *TaskRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_calculation_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TaskRequest.ProtoReflect.Descriptor instead.
+func (*TaskRequest) Descriptor() ([]byte, []int) {
+	return file_v2_calculation_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TaskRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *TaskRequest) GetArg1() string {
+	if x != nil {
+		return x.Arg1
+	}
+	return ""
+}
+
+func (x *TaskRequest) GetArg2() string {
+	if x != nil {
+		return x.Arg2
+	}
+	return ""
+}
+
+func (x *TaskRequest) GetOperator() string {
+	if x != nil {
+		return x.Operator
+	}
+	return ""
+}
+
+func (x *TaskRequest) GetArgs() []string {
+	if x != nil {
+		return x.Args
+	}
+	return nil
+}
+
+func (x *TaskRequest) GetExpressionId() int32 {
+	if x != nil {
+		return x.ExpressionId
+	}
+	return 0
+}
+
+func (x *TaskRequest) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *TaskRequest) GetScale() int32 {
+	if x != nil {
+		return x.Scale
+	}
+	return 0
+}
+
+func (x *TaskRequest) GetRounding() string {
+	if x != nil {
+		return x.Rounding
+	}
+	return ""
+}
+
+func (x *TaskRequest) GetCancel() bool {
+	if x != nil {
+		return x.Cancel
+	}
+	return false
+}
+
+func (x *TaskRequest) GetBudgetMs() int64 {
+	if x != nil {
+		return x.BudgetMs
+	}
+	return 0
+}
+
+type AgentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Result        float64                `protobuf:"fixed64,2,opt,name=result,proto3" json:"result,omitempty"`
+	Error         string                 `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	ExpressionId  int32                  `protobuf:"varint,4,opt,name=expression_id,json=expressionId,proto3" json:"expression_id,omitempty"`
+	Value         string                 `protobuf:"bytes,5,opt,name=value,proto3" json:"value,omitempty"` // точное значение в режимах decimal и rational
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AgentResponse) Reset() {
+	*x = AgentResponse{}
+	mi := &file_v2_calculation_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AgentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AgentResponse) ProtoMessage() {}
+
+func (x *AgentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_calculation_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AgentResponse.ProtoReflect.Descriptor instead.
+func (*AgentResponse) Descriptor() ([]byte, []int) {
+	return file_v2_calculation_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AgentResponse) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *AgentResponse) GetResult() float64 {
+	if x != nil {
+		return x.Result
+	}
+	return 0
+}
+
+func (x *AgentResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *AgentResponse) GetExpressionId() int32 {
+	if x != nil {
+		return x.ExpressionId
+	}
+	return 0
+}
+
+func (x *AgentResponse) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+var File_v2_calculation_proto protoreflect.FileDescriptor
+
+const file_v2_calculation_proto_rawDesc = "" +
+	"\n" +
+	"\x14v2/calculation.proto\x12\fcalculate.v2\"\x95\x02\n" +
+	"\vTaskRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
+	"\x04arg1\x18\x02 \x01(\tR\x04arg1\x12\x12\n" +
+	"\x04arg2\x18\x03 \x01(\tR\x04arg2\x12\x1a\n" +
+	"\boperator\x18\x04 \x01(\tR\boperator\x12\x12\n" +
+	"\x04args\x18\x05 \x03(\tR\x04args\x12#\n" +
+	"\rexpression_id\x18\x06 \x01(\x05R\fexpressionId\x12\x12\n" +
+	"\x04mode\x18\a \x01(\tR\x04mode\x12\x14\n" +
+	"\x05scale\x18\b \x01(\x05R\x05scale\x12\x1a\n" +
+	"\brounding\x18\t \x01(\tR\brounding\x12\x16\n" +
+	"\x06cancel\x18\n" +
+	" \x01(\bR\x06cancel\x12\x1b\n" +
+	"\tbudget_ms\x18\v \x01(\x03R\bbudgetMs\"\x88\x01\n" +
+	"\rAgentResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x16\n" +
+	"\x06result\x18\x02 \x01(\x01R\x06result\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\x12#\n" +
+	"\rexpression_id\x18\x04 \x01(\x05R\fexpressionId\x12\x14\n" +
+	"\x05value\x18\x05 \x01(\tR\x05value2W\n" +
+	"\fOrchestrator\x12G\n" +
+	"\tCalculate\x12\x1b.calculate.v2.AgentResponse\x1a\x19.calculate.v2.TaskRequest(\x010\x01B,Z*github.com/vedsatt/calc_prl/proto/v2;protob\x06proto3"
+
+var (
+	file_v2_calculation_proto_rawDescOnce sync.Once
+	file_v2_calculation_proto_rawDescData []byte
+)
+
+func file_v2_calculation_proto_rawDescGZIP() []byte {
+	file_v2_calculation_proto_rawDescOnce.Do(func() {
+		file_v2_calculation_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_v2_calculation_proto_rawDesc), len(file_v2_calculation_proto_rawDesc)))
+	})
+	return file_v2_calculation_proto_rawDescData
+}
+
+var file_v2_calculation_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_v2_calculation_proto_goTypes = []any{
+	(*TaskRequest)(nil),   // 0: calculate.v2.TaskRequest
+	(*AgentResponse)(nil), // 1: calculate.v2.AgentResponse
+}
+var file_v2_calculation_proto_depIdxs = []int32{
+	1, // 0: calculate.v2.Orchestrator.Calculate:input_type -> calculate.v2.AgentResponse
+	0, // 1: calculate.v2.Orchestrator.Calculate:output_type -> calculate.v2.TaskRequest
+	1, // [1:2] is the sub-list for method output_type
+	0, // [0:1] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_v2_calculation_proto_init() }
+func file_v2_calculation_proto_init() {
+	if File_v2_calculation_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_v2_calculation_proto_rawDesc), len(file_v2_calculation_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_v2_calculation_proto_goTypes,
+		DependencyIndexes: file_v2_calculation_proto_depIdxs,
+		MessageInfos:      file_v2_calculation_proto_msgTypes,
+	}.Build()
+	File_v2_calculation_proto = out.File
+	file_v2_calculation_proto_goTypes = nil
+	file_v2_calculation_proto_depIdxs = nil
+}
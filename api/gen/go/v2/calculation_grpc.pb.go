@@ -2,7 +2,9 @@
 // versions:
 // - protoc-gen-go-grpc v1.5.1
 // - protoc             v6.30.2
-// source: calculation.proto
+// source: v2/calculation.proto
+
+// v2: результат - double, а не float; v1 терял точность уже на седьмом знаке
 
 package proto
 
@@ -19,7 +21,7 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	Orchestrator_Calculate_FullMethodName = "/calculate.Orchestrator/Calculate"
+	Orchestrator_Calculate_FullMethodName = "/calculate.v2.Orchestrator/Calculate"
 )
 
 // OrchestratorClient is the client API for Orchestrator service.
@@ -27,6 +29,7 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type OrchestratorClient interface {
 	// Оркестратор отправляет задания (Task), агент возвращает результаты (Response)
+	// TaskRequest с cancel = true - не задание, а отмена выражения expression_id
 	Calculate(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[AgentResponse, TaskRequest], error)
 }
 
@@ -56,6 +59,7 @@ type Orchestrator_CalculateClient = grpc.BidiStreamingClient[AgentResponse, Task
 // for forward compatibility.
 type OrchestratorServer interface {
 	// Оркестратор отправляет задания (Task), агент возвращает результаты (Response)
+	// TaskRequest с cancel = true - не задание, а отмена выражения expression_id
 	Calculate(grpc.BidiStreamingServer[AgentResponse, TaskRequest]) error
 	mustEmbedUnimplementedOrchestratorServer()
 }
@@ -102,7 +106,7 @@ type Orchestrator_CalculateServer = grpc.BidiStreamingServer[AgentResponse, Task
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var Orchestrator_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "calculate.Orchestrator",
+	ServiceName: "calculate.v2.Orchestrator",
 	HandlerType: (*OrchestratorServer)(nil),
 	Methods:     []grpc.MethodDesc{},
 	Streams: []grpc.StreamDesc{
@@ -113,5 +117,5 @@ var Orchestrator_ServiceDesc = grpc.ServiceDesc{
 			ClientStreams: true,
 		},
 	},
-	Metadata: "calculation.proto",
+	Metadata: "v2/calculation.proto",
 }
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"log"
+	"time"
 
 	"calculator/pkg/config"
 	"calculator/pkg/models"
@@ -12,10 +13,14 @@ type Agent struct {
 }
 
 type Task struct {
-	ID   int
-	Arg1 string
-	Arg2 string
-	Type string
+	ID           int
+	ExpressionID int // id узла уникален только в пределах выражения
+	Arg1         string
+	Arg2         string
+	Args         []string // аргументы функции
+	Type         string
+	Precision    models.Precision
+	Deadline     time.Time // после этого момента результат оркестратору не нужен, нулевой - срока нет
 }
 
 var (
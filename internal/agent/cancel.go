@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"sync"
+	"time"
+)
+
+// сколько помнить отмену: после нее задачи выражения могут только дожидаться своей очереди у воркеров,
+// новые оркестратор уже не отправляет
+const cancelTTL = time.Minute
+
+var cancelled = newCancelSet(cancelTTL)
+
+// cancelSet - отмененные выражения и время их отмены
+type cancelSet struct {
+	mu  sync.Mutex
+	ttl time.Duration
+	ids map[int]time.Time
+}
+
+func newCancelSet(ttl time.Duration) *cancelSet {
+	return &cancelSet{ttl: ttl, ids: make(map[int]time.Time)}
+}
+
+// add запоминает отмену и забывает старые
+func (c *cancelSet) add(id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for old, at := range c.ids {
+		if now.Sub(at) > c.ttl {
+			delete(c.ids, old)
+		}
+	}
+	c.ids[id] = now
+}
+
+func (c *cancelSet) has(id int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.ids[id]
+	return ok
+}
@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"calculator/pkg/config"
+	"calculator/pkg/models"
+)
+
+func TestCancelSet(t *testing.T) {
+	c := newCancelSet(time.Minute)
+	c.add(1)
+	if !c.has(1) || c.has(2) {
+		t.Errorf("has(1), has(2) = %v, %v; expected true, false", c.has(1), c.has(2))
+	}
+
+	// старые отмены забываются при следующей отмене
+	c.ids[1] = time.Now().Add(-2 * time.Minute)
+	c.add(2)
+	if c.has(1) || !c.has(2) {
+		t.Errorf("has(1), has(2) = %v, %v; expected false, true", c.has(1), c.has(2))
+	}
+}
+
+// воркер пропускает задачи отмененного выражения
+func TestWorkerCancelled(t *testing.T) {
+	tasksCh = make(chan *Task, 2)
+	resultsCh = make(chan *models.Result, 2)
+	go worker(config.Config{})
+
+	cancelled.add(41)
+	tasksCh <- &Task{ID: 1, ExpressionID: 41, Arg1: "1", Arg2: "2", Type: "+"}
+	tasksCh <- &Task{ID: 2, ExpressionID: 42, Arg1: "2", Arg2: "3", Type: "+"}
+
+	select {
+	case res := <-resultsCh:
+		if res.ExpressionID != 42 || res.Result != 5 {
+			t.Errorf("result = %+v, expected 5 for expression 42", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker did not calculate the task of expression 42")
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"os"
 	"time"
 
-	pb "github.com/vedsatt/calc_prl/api/gen/go"
+	pb "calculator/api/gen/go/v2"
+	"calculator/pkg/models"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -64,11 +66,31 @@ func handleStream(client pb.OrchestratorClient) error {
 					return
 				}
 
+				if task.Cancel {
+					log.Printf("expression %d cancelled", task.ExpressionId)
+					cancelled.add(int(task.ExpressionId))
+					continue
+				}
+
+				// срок приходит остатком, а не моментом времени: часы агента и оркестратора могут расходиться
+				var deadline time.Time
+				if task.BudgetMs > 0 {
+					deadline = time.Now().Add(time.Duration(task.BudgetMs) * time.Millisecond)
+				}
+
 				tasksCh <- &Task{
-					ID:   int(task.Id),
-					Arg1: task.Arg1,
-					Arg2: task.Arg2,
-					Type: task.Operator,
+					ID:           int(task.Id),
+					ExpressionID: int(task.ExpressionId),
+					Arg1:         task.Arg1,
+					Arg2:         task.Arg2,
+					Args:         task.Args,
+					Type:         task.Operator,
+					Precision: models.Precision{
+						Mode:     task.Mode,
+						Scale:    int(task.Scale),
+						Rounding: task.Rounding,
+					},
+					Deadline: deadline,
 				}
 			}
 		}
@@ -80,9 +102,11 @@ func handleStream(client pb.OrchestratorClient) error {
 			select {
 			case result := <-resultsCh:
 				err := stream.Send(&pb.AgentResponse{
-					Id:     int32(result.ID),
-					Result: float32(result.Result),
-					Error:  result.Error,
+					Id:           int32(result.ID),
+					ExpressionId: int32(result.ExpressionID),
+					Result:       result.Result,
+					Value:        result.Value,
+					Error:        result.Error,
 				})
 				if err != nil {
 					log.Printf("Send error: %v", err)
@@ -1,46 +1,143 @@
 package agent
 
 import (
+	"fmt"
 	"log"
 	"strconv"
 	"time"
 
+	"calculator/pkg/calculator"
 	"calculator/pkg/config"
+	"calculator/pkg/decimal"
+	"calculator/pkg/functions"
 	"calculator/pkg/models"
 )
 
 func worker(cfg config.Config) {
 	for task := range tasksCh {
-		log.Printf("worker got expression with id %v", task.ID)
-		result, err := calculate(task.Arg1, task.Arg2, task.Type, cfg)
+		// задача дождалась очереди уже после отмены выражения, оркестратору ее результат не нужен
+		if cancelled.has(task.ExpressionID) {
+			log.Printf("worker dropped task %v of cancelled expression %v", task.ID, task.ExpressionID)
+			continue
+		}
+		// срок выражения истек, пока задача ждала воркера
+		if !task.Deadline.IsZero() && time.Now().After(task.Deadline) {
+			log.Printf("worker dropped late task %v of expression %v", task.ID, task.ExpressionID)
+			continue
+		}
+		log.Printf("worker got task %v of expression %v", task.ID, task.ExpressionID)
+		var result float64
+		var value, err string
+		switch {
+		case task.Precision.Mode == models.ModeDecimal || task.Precision.Mode == models.ModeRational:
+			result, value, err = calculateExact(task, cfg)
+		case len(task.Args) > 0:
+			result, err = callFunction(task.Type, task.Args, cfg)
+		default:
+			result, err = calculate(task.Arg1, task.Arg2, task.Type, cfg)
+		}
 
-		res := &models.Result{ID: task.ID, Result: result, Error: err}
+		res := &models.Result{ID: task.ID, ExpressionID: task.ExpressionID, Result: result, Value: value, Error: err}
 		resultsCh <- res
 		log.Printf("worker sent result %v with id %v", result, task.ID)
 	}
 }
 
-func calculate(a, b string, operator string, cfg config.Config) (float64, string) {
-	a_float, _ := strconv.ParseFloat(a, 64)
-	b_float, _ := strconv.ParseFloat(b, 64)
+// sleep имитирует долгую операцию, задержка из конфига передается в time.Sleep как есть
+func sleep(d int) {
+	time.Sleep(time.Duration(d))
+}
 
+// operand разбирает аргумент задачи; пустой второй аргумент бывает у унарных операторов
+func operand(s string) (float64, string) {
+	if s == "" {
+		return 0, ""
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Sprintf("invalid operand %q", s)
+	}
+	return value, ""
+}
+
+// delay - имитируемое время операции
+func delay(operator string, cfg config.Config) int {
 	switch operator {
+	case "+":
+		return cfg.AddTimeMs
+	case "-", models.Negation:
+		return cfg.SubtractTimeMs
 	case "*":
-		time.Sleep(time.Duration(cfg.MultiplyTimeMs))
-		return a_float * b_float, ""
+		return cfg.MultiplyTimeMs
 	case "/":
-		time.Sleep(time.Duration(cfg.DivideTimeMs))
-		if b_float == 0 {
-			return 0, "division by zero"
-		}
-		return a_float / b_float, ""
-	case "+":
-		time.Sleep(time.Duration(cfg.AddTimeMs))
-		return a_float + b_float, ""
-	case "-":
-		time.Sleep(time.Duration(cfg.DivideTimeMs))
-		return a_float - b_float, ""
+		return cfg.DivideTimeMs
+	case "//":
+		return cfg.FloorDivideTimeMs
+	case "%":
+		return cfg.ModuloTimeMs
+	case "^":
+		return cfg.PowerTimeMs
+	case "!":
+		return cfg.FactorialTimeMs
+	case "<", "<=", ">", ">=", "==", "!=", "&&", "||", models.Not:
+		return cfg.LogicTimeMs
 	default:
-		return 0, ""
+		return 0
+	}
+}
+
+func calculate(a, b string, operator string, cfg config.Config) (float64, string) {
+	a_float, err := operand(a)
+	if err != "" {
+		return 0, err
+	}
+	b_float, err := operand(b)
+	if err != "" {
+		return 0, err
+	}
+
+	sleep(delay(operator, cfg))
+	result, calcErr := calculator.Apply(operator, a_float, b_float)
+	if calcErr != nil {
+		return 0, calcErr.Error()
+	}
+	return result, ""
+}
+
+// calculateExact считает задачу в точном режиме (decimal или rational)
+// возвращает приближение результата и его точную запись
+func calculateExact(task *Task, cfg config.Config) (float64, string, string) {
+	ctx := decimal.FromPrecision(task.Precision)
+
+	var value string
+	var err error
+	if len(task.Args) > 0 {
+		sleep(cfg.FunctionTimeMs)
+		value, err = ctx.Call(task.Type, task.Args)
+	} else {
+		sleep(delay(task.Type, cfg))
+		value, err = ctx.Calculate(task.Type, task.Arg1, task.Arg2)
+	}
+	if err != nil {
+		return 0, "", err.Error()
+	}
+	return decimal.Approx(value), value, ""
+}
+
+func callFunction(name string, args []string, cfg config.Config) (float64, string) {
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		var err string
+		if values[i], err = operand(arg); err != "" {
+			return 0, err
+		}
+	}
+
+	sleep(cfg.FunctionTimeMs)
+	result, err := functions.Call(name, values)
+	if err != nil {
+		return 0, err.Error()
 	}
+	return result, ""
 }
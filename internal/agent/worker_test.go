@@ -131,6 +131,31 @@ func TestCalculate(t *testing.T) {
 		{"4", "3", "*", 12.0, ""},
 		{"10", "2", "/", 5.0, ""},
 		{"10", "0", "/", 0.0, "division by zero"}, // деление на ноль
+		{"3", "", models.Negation, -3.0, ""},      // унарный минус
+		{"1.2.3", "1", "+", 0.0, `invalid operand "1.2.3"`},
+		{"7", "2", "//", 3.0, ""},
+		{"-7", "2", "//", -4.0, ""},
+		{"7", "0", "//", 0.0, "division by zero"},
+		{"7", "3", "%", 1.0, ""},
+		{"-7", "3", "%", 2.0, ""}, // знак остатка совпадает со знаком делителя
+		{"7", "-3", "%", -2.0, ""},
+		{"5.5", "2", "%", 1.5, ""},
+		{"7", "0", "%", 0.0, "division by zero"},
+		{"5", "", "!", 120.0, ""},
+		{"0", "", "!", 1.0, ""},
+		{"-1", "", "!", 0.0, "factorial is defined only for non-negative integers, got -1"},
+		{"2.5", "", "!", 0.0, "factorial is defined only for non-negative integers, got 2.5"},
+		{"171", "", "!", 0.0, "factorial result is out of range"},
+		{"1", "2", "<", 1.0, ""},
+		{"2", "2", "<=", 1.0, ""},
+		{"1", "2", ">", 0.0, ""},
+		{"2", "2", ">=", 1.0, ""},
+		{"2", "2", "==", 1.0, ""},
+		{"2", "2", "!=", 0.0, ""},
+		{"2", "0", "&&", 0.0, ""},
+		{"0", "-3", "||", 1.0, ""},
+		{"0", "", models.Not, 1.0, ""},
+		{"5", "", models.Not, 0.0, ""},
 	}
 
 	for _, tt := range tests {
@@ -141,6 +166,74 @@ func TestCalculate(t *testing.T) {
 	}
 }
 
+func TestCallFunction(t *testing.T) {
+	tests := []struct {
+		name         string
+		args         []string
+		expected     float64
+		expected_err string
+	}{
+		{"sqrt", []string{"16"}, 4.0, ""},
+		{"max", []string{"1", "-2", "3.5"}, 3.5, ""},
+		{"round", []string{"2.345", "2"}, 2.35, ""},
+		{"sqrt", []string{"-1"}, 0.0, "argument is out of the function domain: sqrt: argument must be non-negative, got -1"},
+	}
+
+	for _, tt := range tests {
+		result, err := callFunction(tt.name, tt.args, config.Config{})
+		if result != tt.expected || err != tt.expected_err {
+			t.Errorf("callFunction(%s, %v) = %v, %q; expected %v, %q", tt.name, tt.args, result, err, tt.expected, tt.expected_err)
+		}
+	}
+}
+
+func TestCalculateExact(t *testing.T) {
+	decimal := models.Precision{Mode: models.ModeDecimal, Scale: 20, Rounding: "half_even"}
+	tests := []struct {
+		task           Task
+		expected       float64
+		expected_value string
+		expected_err   string
+	}{
+		{Task{Arg1: "0.1", Arg2: "0.2", Type: "+"}, 0.3, "0.3", ""},
+		{Task{Arg1: "1", Arg2: "3", Type: "/"}, 0.3333333333333333, "0.33333333333333333333", ""},
+		{Task{Arg1: "-7", Arg2: "2", Type: "%"}, 1, "1", ""},
+		{Task{Arg1: "25", Arg2: "", Type: "!"}, 1.5511210043330986e25, "15511210043330985984000000", ""},
+		{Task{Arg1: "2", Arg2: "0.5", Type: "^"}, 0, "", "non-integer powers are not supported in decimal mode"},
+		{Task{Arg1: "1", Arg2: "0", Type: "/"}, 0, "", "division by zero"},
+		{Task{Args: []string{"2.345", "2"}, Type: "round"}, 2.35, "2.35", ""},
+		{Task{Args: []string{"1"}, Type: "sin"}, 0, "", "function sin is not supported in decimal mode"},
+	}
+
+	for _, tt := range tests {
+		tt.task.Precision = decimal
+		result, value, err := calculateExact(&tt.task, config.Config{})
+		if result != tt.expected || value != tt.expected_value || err != tt.expected_err {
+			t.Errorf("calculateExact(%s %s %s %v) = %v, %q, %q; expected %v, %q, %q", tt.task.Arg1, tt.task.Type, tt.task.Arg2, tt.task.Args,
+				result, value, err, tt.expected, tt.expected_value, tt.expected_err)
+		}
+	}
+
+	rational := models.Precision{Mode: models.ModeRational}
+	for _, tt := range []struct {
+		task           Task
+		expected       float64
+		expected_value string
+		expected_err   string
+	}{
+		{Task{Arg1: "1/3", Arg2: "1/6", Type: "+"}, 0.5, "1/2", ""},
+		{Task{Arg1: "1", Arg2: "3", Type: "/"}, 1.0 / 3, "1/3", ""},
+		{Task{Args: []string{"2"}, Type: "sqrt"}, 0, "", "sqrt: result is irrational, got 2"},
+	} {
+		tt.task.Precision = rational
+		result, value, err := calculateExact(&tt.task, config.Config{})
+		if result != tt.expected || value != tt.expected_value || err != tt.expected_err {
+			t.Errorf("calculateExact(%s %s %s %v) = %v, %q, %q; expected %v, %q, %q", tt.task.Arg1, tt.task.Type, tt.task.Arg2, tt.task.Args,
+				result, value, err, tt.expected, tt.expected_value, tt.expected_err)
+		}
+	}
+}
+
 func TestWorker(t *testing.T) {
 	// Создаем mock-сервер
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -179,3 +272,22 @@ func TestWorker(t *testing.T) {
 	go worker(config.Config{})
 	time.Sleep(5 * time.Second) // Даем время воркеру выполнить свою работу
 }
+
+// воркер пропускает задачи, срок которых истек в очереди
+func TestWorkerLate(t *testing.T) {
+	tasksCh = make(chan *Task, 2)
+	resultsCh = make(chan *models.Result, 2)
+	go worker(config.Config{})
+
+	tasksCh <- &Task{ID: 1, ExpressionID: 51, Arg1: "1", Arg2: "2", Type: "+", Deadline: time.Now().Add(-time.Second)}
+	tasksCh <- &Task{ID: 2, ExpressionID: 52, Arg1: "2", Arg2: "3", Type: "+", Deadline: time.Now().Add(time.Minute)}
+
+	select {
+	case res := <-resultsCh:
+		if res.ExpressionID != 52 || res.Result != 5 {
+			t.Errorf("result = %+v, expected 5 for expression 52", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("worker did not calculate the task of expression 52")
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+// кэш результатов задач: одинаковый оператор с одинаковыми операндами в одном режиме чисел
+// всегда дает один и тот же результат, поэтому его можно не отправлять агенту повторно
+// в памяти хранится ограниченный LRU, за ним может стоять постоянный уровень (Postgres)
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"calculator/pkg/models"
+)
+
+// Entry - закэшированный результат задачи
+type Entry struct {
+	Result float64
+	Value  string // точное значение в точных режимах
+}
+
+// Tier - постоянный уровень кэша
+type Tier interface {
+	Get(ctx context.Context, key string) (Entry, bool, error)
+	Put(ctx context.Context, key string, entry Entry) error
+}
+
+// Stats - счетчики кэша
+type Stats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	TierHits int64 `json:"tier_hits"` // из Hits - найдено только в постоянном уровне
+	Size     int   `json:"size"`      // записей в памяти
+}
+
+type Cache struct {
+	mem  *lru
+	tier Tier // nil - только память
+
+	hits, misses, tierHits atomic.Int64
+}
+
+// New создает кэш на size записей в памяти; tier может быть nil
+func New(size int, tier Tier) *Cache {
+	return &Cache{mem: newLRU(size), tier: tier}
+}
+
+// Key - адрес задачи по содержимому: режим чисел, оператор и значения операндов
+func Key(precision models.Precision, operator string, args []string) string {
+	mode := precision.Mode
+	if mode == "" {
+		mode = models.ModeFloat
+	}
+
+	parts := []string{mode, strconv.Itoa(precision.Scale), precision.Rounding, operator}
+	sum := sha256.Sum256([]byte(strings.Join(append(parts, args...), "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get ищет результат сначала в памяти, затем в постоянном уровне
+func (c *Cache) Get(ctx context.Context, key string) (Entry, bool) {
+	if entry, ok := c.mem.get(key); ok {
+		c.hits.Add(1)
+		return entry, true
+	}
+
+	if c.tier != nil {
+		entry, ok, err := c.tier.Get(ctx, key)
+		if err != nil {
+			log.Printf("cache: %v", err)
+		}
+		if ok {
+			c.mem.put(key, entry)
+			c.hits.Add(1)
+			c.tierHits.Add(1)
+			return entry, true
+		}
+	}
+
+	c.misses.Add(1)
+	return Entry{}, false
+}
+
+// Put сохраняет результат в память и в постоянный уровень
+func (c *Cache) Put(ctx context.Context, key string, entry Entry) {
+	c.mem.put(key, entry)
+	if c.tier != nil {
+		if err := c.tier.Put(ctx, key, entry); err != nil {
+			log.Printf("cache: %v", err)
+		}
+	}
+}
+
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		TierHits: c.tierHits.Load(),
+		Size:     c.mem.len(),
+	}
+}
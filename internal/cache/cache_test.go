@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"calculator/pkg/models"
+)
+
+func TestLRU(t *testing.T) {
+	l := newLRU(2)
+	l.put("a", Entry{Result: 1})
+	l.put("b", Entry{Result: 2})
+	l.get("a") // b становится самым старым
+	l.put("c", Entry{Result: 3})
+
+	if _, ok := l.get("b"); ok {
+		t.Error("b should be evicted")
+	}
+	for key, expected := range map[string]float64{"a": 1, "c": 3} {
+		if entry, ok := l.get(key); !ok || entry.Result != expected {
+			t.Errorf("get(%s) = %v, %v; expected %v", key, entry.Result, ok, expected)
+		}
+	}
+	if l.len() != 2 {
+		t.Errorf("len = %d, expected 2", l.len())
+	}
+
+	empty := newLRU(0)
+	empty.put("a", Entry{Result: 1})
+	if _, ok := empty.get("a"); ok {
+		t.Error("LRU with zero capacity should not store entries")
+	}
+}
+
+func TestKey(t *testing.T) {
+	floatMode := models.Precision{Mode: models.ModeFloat}
+	base := Key(floatMode, "+", []string{"1", "2"})
+
+	if Key(models.Precision{}, "+", []string{"1", "2"}) != base {
+		t.Error("empty mode should be the same as float")
+	}
+
+	tests := []struct {
+		name      string
+		precision models.Precision
+		operator  string
+		args      []string
+	}{
+		{"mode", models.Precision{Mode: models.ModeRational}, "+", []string{"1", "2"}},
+		{"scale", models.Precision{Mode: models.ModeDecimal, Scale: 2}, "+", []string{"1", "2"}},
+		{"rounding", models.Precision{Mode: models.ModeDecimal, Scale: 2, Rounding: "down"}, "+", []string{"1", "2"}},
+		{"operator", floatMode, "*", []string{"1", "2"}},
+		{"operand order", floatMode, "+", []string{"2", "1"}},
+		{"operand split", floatMode, "+", []string{"12"}},
+		{"function", floatMode, "max", []string{"1", "2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if Key(tt.precision, tt.operator, tt.args) == base {
+				t.Errorf("Key(%+v, %s, %v) should differ from float 1+2", tt.precision, tt.operator, tt.args)
+			}
+		})
+	}
+}
+
+// fakeTier - постоянный уровень в памяти
+type fakeTier struct {
+	entries map[string]Entry
+	err     error
+}
+
+func (f *fakeTier) Get(_ context.Context, key string) (Entry, bool, error) {
+	entry, ok := f.entries[key]
+	return entry, ok, f.err
+}
+
+func (f *fakeTier) Put(_ context.Context, key string, entry Entry) error {
+	f.entries[key] = entry
+	return f.err
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	tier := &fakeTier{entries: map[string]Entry{"stored": {Result: 0.5, Value: "1/2"}}}
+	c := New(10, tier)
+
+	if _, ok := c.Get(ctx, "missing"); ok {
+		t.Error("Get(missing) should miss")
+	}
+
+	// найденное в постоянном уровне поднимается в память
+	if entry, ok := c.Get(ctx, "stored"); !ok || entry.Value != "1/2" {
+		t.Errorf("Get(stored) = %+v, %v; expected 1/2", entry, ok)
+	}
+	delete(tier.entries, "stored")
+	if _, ok := c.Get(ctx, "stored"); !ok {
+		t.Error("Get(stored) should hit memory")
+	}
+
+	c.Put(ctx, "new", Entry{Result: 3})
+	if tier.entries["new"].Result != 3 {
+		t.Error("Put should write through to the tier")
+	}
+
+	expected := Stats{Hits: 2, Misses: 1, TierHits: 1, Size: 2}
+	if stats := c.Stats(); stats != expected {
+		t.Errorf("Stats = %+v, expected %+v", stats, expected)
+	}
+
+	// ошибка постоянного уровня - промах, а не отказ
+	tier.err = errors.New("connection refused")
+	if _, ok := c.Get(ctx, "other"); ok {
+		t.Error("Get with a failing tier should miss")
+	}
+}
@@ -0,0 +1,67 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru - ограниченный кэш в памяти, при переполнении вытесняется давно не использованная запись
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // от недавно использованных к давно использованным
+	items    map[string]*list.Element
+}
+
+type item struct {
+	key   string
+	entry Entry
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (l *lru) get(key string) (Entry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	el, ok := l.items[key]
+	if !ok {
+		return Entry{}, false
+	}
+	l.order.MoveToFront(el)
+	return el.Value.(*item).entry, true
+}
+
+func (l *lru) put(key string, entry Entry) {
+	if l.capacity <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		el.Value.(*item).entry = entry
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.items[key] = l.order.PushFront(&item{key: key, entry: entry})
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*item).key)
+	}
+}
+
+func (l *lru) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.order.Len()
+}
@@ -4,15 +4,21 @@ import (
 	"calculator/pkg/models"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
+	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 )
 
 // DB — обёртка над соединением с базой данных
+// pgx.Conn не потокобезопасен, а выражения считаются в фоне, поэтому запросы сериализуются мьютексом
 type DB struct {
 	*pgx.Conn
+	mu sync.Mutex
 }
 
 // NewDB создаёт новое соединение с PostgreSQL
@@ -59,6 +65,9 @@ func (db *DB) InsertUser(ctx context.Context, user *models.User) (int, error) {
 		return 0, fmt.Errorf("database connection is nil")
 	}
 
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	login := user.Login
 	passwordHash := user.Password
 
@@ -80,6 +89,9 @@ func (db *DB) SelectUserByLogin(ctx context.Context, login string) (int, string,
 		return 0, "", fmt.Errorf("database connection is nil")
 	}
 
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	var id int
 	var passwordHash string
 
@@ -92,14 +104,83 @@ func (db *DB) SelectUserByLogin(ctx context.Context, login string) (int, string,
 	return id, passwordHash, nil
 }
 
-// UpdateExpression обновляет статус и результат выражения
-func (db *DB) UpdateExpression(ctx context.Context, id int, status string, result float64) error {
+// UpdateExpressionStatus меняет статус выражения, пока оно считается
+// отмененное выражение статус не меняет: отмена окончательна
+func (db *DB) UpdateExpressionStatus(ctx context.Context, id int, status string) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, err := db.Exec(ctx, `
+        UPDATE expressions SET status = $1 WHERE id = $2 AND status <> 'cancelled'`, status, id)
+	if err != nil {
+		return fmt.Errorf("failed to update expression status: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateExpression записывает итоговый статус и результат выражения
+// exact - точный результат в точных режимах, в режиме float пустой
+// fraction - результат режима rational, его числитель и знаменатель хранятся отдельно
+func (db *DB) UpdateExpression(ctx context.Context, id int, status string, result float64, exact string, fraction *big.Rat) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	var num, den string
+	if fraction != nil {
+		num, den = fraction.Num().String(), fraction.Denom().String()
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, err := db.Exec(ctx, `
+        UPDATE expressions SET status = $1, result = $2, exact_result = NULLIF($3, ''),
+            numerator = NULLIF($4, '')::numeric, denominator = NULLIF($5, '')::numeric, finished_at = CURRENT_TIMESTAMP
+        WHERE id = $6 AND status <> 'cancelled'`, status, result, exact, num, den, id)
+	if err != nil {
+		return fmt.Errorf("failed to update expression: %w", err)
+	}
+
+	return nil
+}
+
+// FailExpression помечает выражение ошибкой и сохраняет ее причину
+func (db *DB) FailExpression(ctx context.Context, id int, reason string) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, err := db.Exec(ctx, `
+        UPDATE expressions SET status = 'error', error = $1, finished_at = CURRENT_TIMESTAMP
+        WHERE id = $2 AND status <> 'cancelled'`, reason, id)
+	if err != nil {
+		return fmt.Errorf("failed to update expression: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireExpression завершает выражение, не посчитанное к сроку
+func (db *DB) ExpireExpression(ctx context.Context, id int, reason string) error {
 	if db == nil || db.Conn == nil {
 		return fmt.Errorf("database connection is nil")
 	}
 
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	_, err := db.Exec(ctx, `
-        UPDATE expressions SET status = $1, result = $2 WHERE id = $3`, status, result, id)
+        UPDATE expressions SET status = 'timeout', error = $1, finished_at = CURRENT_TIMESTAMP
+        WHERE id = $2 AND status <> 'cancelled'`, reason, id)
 	if err != nil {
 		return fmt.Errorf("failed to update expression: %w", err)
 	}
@@ -107,23 +188,58 @@ func (db *DB) UpdateExpression(ctx context.Context, id int, status string, resul
 	return nil
 }
 
+// CancelExpression отменяет выражение пользователя, если оно еще считается
+// false - выражения нет или оно уже завершилось
+func (db *DB) CancelExpression(ctx context.Context, exprID, userID int) (bool, error) {
+	if db == nil || db.Conn == nil {
+		return false, fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	tag, err := db.Exec(ctx, `
+        UPDATE expressions SET status = 'cancelled', finished_at = CURRENT_TIMESTAMP
+        WHERE id = $1 AND user_id = $2 AND status IN ('pending', 'processing')`, exprID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel expression: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
 // SelectExprByID выбирает выражение по ID и UserID
-func (db *DB) SelectExprByID(ctx context.Context, exprID, userID int) (string, string, error) {
+func (db *DB) SelectExprByID(ctx context.Context, exprID, userID int) (*models.Expression, error) {
 	if db == nil || db.Conn == nil {
-		return "", "", fmt.Errorf("database connection is nil")
+		return nil, fmt.Errorf("database connection is nil")
 	}
 
-	var expression string
-	var status string
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var result sql.NullFloat64
+	var createdAt string
+	var finishedAt sql.NullString
+	var reason sql.NullString
+	var exact sql.NullString
+	var normalized sql.NullString
+	expr := &models.Expression{ID: exprID, UserID: userID}
 
 	err := db.QueryRow(ctx, `
-        SELECT expression, status FROM expressions
-        WHERE id = $1 AND user_id = $2`, exprID, userID).Scan(&expression, &status)
+        SELECT expression, normalized, status, result, created_at::text, finished_at::text, error, exact_result FROM expressions
+        WHERE id = $1 AND user_id = $2`, exprID, userID).Scan(&expr.Expression, &normalized, &expr.Status, &result, &createdAt, &finishedAt, &reason, &exact)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to get expression by ID: %w", err)
+		return nil, fmt.Errorf("failed to get expression by ID: %w", err)
 	}
 
-	return expression, status, nil
+	expr.Normalized = normalized.String
+	expr.Result = result.Float64
+	expr.CreatedAt = createdAt
+	expr.FinishedAt = finishedAt.String
+	expr.Error = reason.String
+	expr.Exact = exact.String
+
+	return expr, nil
 }
 
 // SelectExpressions выбирает все выражения пользователя
@@ -132,10 +248,14 @@ func (db *DB) SelectExpressions(ctx context.Context, userID int) ([]map[string]i
 		return nil, fmt.Errorf("database connection is nil")
 	}
 
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	rows, err := db.Query(ctx, `
-        SELECT id, expression, status, result, created_at, finished_at
+        SELECT id, expression, normalized, status, result, created_at::text, finished_at::text, error, exact_result
         FROM expressions
-        WHERE user_id = $1`, userID)
+        WHERE user_id = $1
+        ORDER BY id`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query expressions: %w", err)
 	}
@@ -146,12 +266,15 @@ func (db *DB) SelectExpressions(ctx context.Context, userID int) ([]map[string]i
 	for rows.Next() {
 		var id int
 		var expression string
+		var normalized sql.NullString
 		var status string
 		var result sql.NullFloat64
 		var createdAt string
 		var finishedAt sql.NullString
+		var reason sql.NullString
+		var exact sql.NullString
 
-		if err := rows.Scan(&id, &expression, &status, &result, &createdAt, &finishedAt); err != nil {
+		if err := rows.Scan(&id, &expression, &normalized, &status, &result, &createdAt, &finishedAt, &reason, &exact); err != nil {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
@@ -163,6 +286,17 @@ func (db *DB) SelectExpressions(ctx context.Context, userID int) ([]map[string]i
 			"result":      result.Float64,
 			"finished_at": finishedAt.String,
 		}
+		if normalized.Valid {
+			expr["normalized"] = normalized.String
+		}
+		if reason.Valid {
+			expr["error"] = reason.String
+		}
+		// в точных режимах result - точная строка, как и в SelectExprByID
+		if exact.Valid {
+			expr["result"] = exact.String
+			expr["approx"] = result.Float64
+		}
 
 		expressions = append(expressions, expr)
 	}
@@ -174,20 +308,251 @@ func (db *DB) SelectExpressions(ctx context.Context, userID int) ([]map[string]i
 	return expressions, nil
 }
 
-// InsertExpression добавляет новое выражение
-func (db *DB) InsertExpression(ctx context.Context, userID int, expression string) (int, error) {
+// InsertExpression добавляет новое выражение вместе с его канонической записью
+func (db *DB) InsertExpression(ctx context.Context, userID int, expression, normalized string) (int, error) {
 	if db == nil || db.Conn == nil {
 		return 0, fmt.Errorf("database connection is nil")
 	}
 
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
 	var exprID int
 	err := db.QueryRow(ctx, `
-        INSERT INTO expressions (user_id, expression, status)
-        VALUES ($1, $2, 'pending')
-        RETURNING id`, userID, expression).Scan(&exprID)
+        INSERT INTO expressions (user_id, expression, normalized, status)
+        VALUES ($1, $2, $3, 'pending')
+        RETURNING id`, userID, expression, normalized).Scan(&exprID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert expression: %w", err)
 	}
 
 	return exprID, nil
 }
+
+// SelectCachedResult ищет результат задачи в кэше по ее ключу
+func (db *DB) SelectCachedResult(ctx context.Context, key string) (float64, string, bool, error) {
+	if db == nil || db.Conn == nil {
+		return 0, "", false, fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var result float64
+	var value sql.NullString
+	err := db.QueryRow(ctx, `
+        SELECT result, value FROM result_cache WHERE key = $1`, key).Scan(&result, &value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, "", false, nil
+	}
+	if err != nil {
+		return 0, "", false, fmt.Errorf("failed to select cached result: %w", err)
+	}
+
+	return result, value.String, true, nil
+}
+
+// InsertCachedResult сохраняет результат задачи в кэш; результат по ключу не меняется, поэтому повтор игнорируется
+func (db *DB) InsertCachedResult(ctx context.Context, key string, result float64, value string) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, err := db.Exec(ctx, `
+        INSERT INTO result_cache (key, result, value)
+        VALUES ($1, $2, NULLIF($3, ''))
+        ON CONFLICT (key) DO NOTHING`, key, result, value)
+	if err != nil {
+		return fmt.Errorf("failed to insert cached result: %w", err)
+	}
+
+	return nil
+}
+
+// SaveExpressionState сохраняет дерево выражения и режим чисел, чтобы досчитать выражение после перезапуска
+func (db *DB) SaveExpressionState(ctx context.Context, state models.ExpressionState) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	p := state.Precision
+	var deadline *time.Time
+	if !state.Deadline.IsZero() {
+		deadline = &state.Deadline
+	}
+	_, err := db.Exec(ctx, `
+        UPDATE expressions SET tree = $1, mode = NULLIF($2, ''), scale = $3, rounding = NULLIF($4, ''), no_cache = $5, deadline = $6,
+            priority = NULLIF($7, '')
+        WHERE id = $8`, state.Tree, p.Mode, p.Scale, p.Rounding, state.NoCache, deadline, state.Priority, state.ID)
+	if err != nil {
+		return fmt.Errorf("failed to save expression state: %w", err)
+	}
+
+	return nil
+}
+
+// SelectUnfinishedExpressions выбирает выражения, которые не успели досчитаться
+func (db *DB) SelectUnfinishedExpressions(ctx context.Context) ([]models.ExpressionState, error) {
+	if db == nil || db.Conn == nil {
+		return nil, fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	rows, err := db.Query(ctx, `
+        SELECT id, tree, mode, scale, rounding, no_cache, deadline, user_id, priority FROM expressions
+        WHERE status IN ('pending', 'processing')
+        ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unfinished expressions: %w", err)
+	}
+	defer rows.Close()
+
+	var states []models.ExpressionState
+	for rows.Next() {
+		var state models.ExpressionState
+		var mode, rounding, priority sql.NullString
+		var scale sql.NullInt32
+		var deadline *time.Time
+
+		if err := rows.Scan(&state.ID, &state.Tree, &mode, &scale, &rounding, &state.NoCache, &deadline, &state.UserID, &priority); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		state.Precision = models.Precision{Mode: mode.String, Scale: int(scale.Int32), Rounding: rounding.String}
+		if deadline != nil {
+			state.Deadline = *deadline
+		}
+		state.Priority = priority.String
+		states = append(states, state)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return states, nil
+}
+
+// QueueTask записывает готовую задачу, которая ждет агента
+func (db *DB) QueueTask(ctx context.Context, exprID, nodeID int, op string, args []string) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, err := db.Exec(ctx, `
+        INSERT INTO tasks (expression_id, node_id, op, args, status)
+        VALUES ($1, $2, $3, $4, 'queued')
+        ON CONFLICT (expression_id, node_id)
+        DO UPDATE SET op = $3, args = $4, status = 'queued', updated_at = CURRENT_TIMESTAMP`, exprID, nodeID, op, args)
+	if err != nil {
+		return fmt.Errorf("failed to queue task: %w", err)
+	}
+
+	return nil
+}
+
+// StartTask отмечает, что задача отдана агенту; owner - имя потока агента, который ее взял
+func (db *DB) StartTask(ctx context.Context, exprID, nodeID int, owner string) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, err := db.Exec(ctx, `
+        UPDATE tasks SET status = 'running', lease_owner = NULLIF($3, ''), attempts = attempts + 1, updated_at = CURRENT_TIMESTAMP
+        WHERE expression_id = $1 AND node_id = $2`, exprID, nodeID, owner)
+	if err != nil {
+		return fmt.Errorf("failed to start task: %w", err)
+	}
+
+	return nil
+}
+
+// FinishTask сохраняет результат задачи
+func (db *DB) FinishTask(ctx context.Context, exprID int, res models.Result) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	status := models.TaskDone
+	if res.Error != "" {
+		status = models.TaskError
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, err := db.Exec(ctx, `
+        UPDATE tasks SET status = $3, result = $4, value = NULLIF($5, ''), error = NULLIF($6, ''), updated_at = CURRENT_TIMESTAMP
+        WHERE expression_id = $1 AND node_id = $2`, exprID, res.ID, status, res.Result, res.Value, res.Error)
+	if err != nil {
+		return fmt.Errorf("failed to finish task: %w", err)
+	}
+
+	return nil
+}
+
+// SelectTaskResults выбирает результаты посчитанных задач выражения
+func (db *DB) SelectTaskResults(ctx context.Context, exprID int) ([]models.Result, error) {
+	if db == nil || db.Conn == nil {
+		return nil, fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	rows, err := db.Query(ctx, `
+        SELECT node_id, result, value FROM tasks
+        WHERE expression_id = $1 AND status = 'done'`, exprID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query task results: %w", err)
+	}
+	defer rows.Close()
+
+	var results []models.Result
+	for rows.Next() {
+		res := models.Result{ExpressionID: exprID}
+		var value sql.NullString
+		if err := rows.Scan(&res.ID, &res.Result, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		res.Value = value.String
+		results = append(results, res)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows iteration error: %w", err)
+	}
+
+	return results, nil
+}
+
+// DeleteTasks удаляет задачи завершенного выражения
+func (db *DB) DeleteTasks(ctx context.Context, exprID int) error {
+	if db == nil || db.Conn == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	_, err := db.Exec(ctx, `
+        DELETE FROM tasks WHERE expression_id = $1`, exprID)
+	if err != nil {
+		return fmt.Errorf("failed to delete tasks: %w", err)
+	}
+
+	return nil
+}
@@ -1,132 +1,313 @@
 package orchestrator
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"log"
+	"math/big"
 	"strconv"
 	"sync"
 	"time"
 
+	pb "calculator/api/gen/go/v2"
+	"calculator/internal/cache"
+	"calculator/internal/database"
+	"calculator/pkg/calculator"
+	"calculator/pkg/decimal"
 	"calculator/pkg/models"
 )
 
 var (
-	managerCh = make(chan channels)
-	tasksCh   = make(chan *models.AstNode)
+	tasksCh   = make(chan task)
 	resultsCh = make(chan models.Result)
+	exprs     = registry{results: make(map[int]chan models.Result), cancels: make(map[int]chan struct{})}
 )
 
-type channels struct {
-	tasks   *chan *models.AstNode
-	results *chan models.Result
+// task - готовый к вычислению узел; id узла уникален только в пределах выражения,
+// поэтому задача всегда адресуется парой (id выражения, id узла)
+type task struct {
+	exprID    int
+	node      *models.AstNode
+	precision models.Precision
+	deadline  time.Time       // срок выражения, нулевой - срока нет
+	user      int             // чья это задача: у каждого пользователя своя очередь в планировщике
+	priority  string          // класс приоритета: interactive или batch
+	db        *database.DB    // куда записывать аренду задачи, nil - никуда
+	req       *pb.TaskRequest // уже собранная задача при повторной отправке, узел к этому времени мог измениться
+}
+
+// registry хранит каналы результатов выражений, которые сейчас считаются, и каналы их отмены
+type registry struct {
+	mu      sync.Mutex
+	results map[int]chan models.Result
+	cancels map[int]chan struct{}
 }
 
 type expression struct {
+	id        int
 	node      *models.AstNode
-	tasks     chan *models.AstNode
+	precision models.Precision
 	results   chan models.Result
+	cancelled <-chan struct{} // закрыт - выражение отменено
+	deadline  time.Time       // срок вычисления, нулевой - срока нет
+	ctx       context.Context // истекает в срок выражения
+	user      int
+	priority  string // класс приоритета в планировщике, пустой - interactive
 	currTasks map[int]*models.AstNode
+	cache     *cache.Cache          // nil - кэш не используется
+	keys      map[int]string        // ключи кэша отправленных задач по id узла
+	db        *database.DB          // nil - задачи не сохраняются
+	recovered map[int]models.Result // результаты задач, посчитанных до перезапуска
 }
 
 func StartManager() {
 	log.Println("Starting channel manager...")
-	go channelsManager(managerCh)
+	go exprs.dispatch(resultsCh)
+	go leases.watch()
+	go sched.run()
 }
 
-func channelsManager(chans chan channels) {
-	chanMap := make(map[int]channels)
-	mu := &sync.Mutex{}
+// dispatch раздает результаты агентов выражениям по их id
+func (r *registry) dispatch(results <-chan models.Result) {
 	log.Println("Channel manager started successfully")
 
-	for ch := range chans {
-		go func(ch channels, chanMap map[int]channels, mu *sync.Mutex) {
-			for {
-				task, ok := <-*ch.tasks
-				if !ok {
-					return
-				}
-
-				mu.Lock()
-				chanMap[task.ID] = ch
-				mu.Unlock()
-				tasksCh <- task
-			}
-		}(ch, chanMap, mu)
-
-		go func(ch channels, chanMap map[int]channels, mu *sync.Mutex) {
-			for {
-				result, ok := <-resultsCh
-				if !ok {
-					return
-				}
-				if chans, ok := chanMap[result.ID]; ok {
-					*chans.results <- result
-
-					mu.Lock()
-					delete(chanMap, result.ID)
-					mu.Unlock()
-				}
-			}
-		}(ch, chanMap, mu)
+	for res := range results {
+		r.mu.Lock()
+		ch, ok := r.results[res.ExpressionID]
+		r.mu.Unlock()
+
+		// выражение уже завершилось - результат опоздал
+		if !ok {
+			log.Printf("dropping result for finished expression %d, node %d", res.ExpressionID, res.ID)
+			continue
+		}
+		ch <- res
 	}
 }
 
-func NewExpression(node *models.AstNode) *expression {
-	tasks := make(chan *models.AstNode)
-	results := make(chan models.Result)
+func (r *registry) register(id int, size int) (chan models.Result, <-chan struct{}) {
+	// буфера хватает на все узлы выражения, поэтому dispatch никогда не блокируется
+	ch := make(chan models.Result, size)
+	cancelled := make(chan struct{})
+
+	r.mu.Lock()
+	r.results[id] = ch
+	r.cancels[id] = cancelled
+	r.mu.Unlock()
+	return ch, cancelled
+}
+
+// active - считается ли выражение сейчас
+func (r *registry) active(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.results[id]
+	return ok
+}
+
+func (r *registry) unregister(id int) {
+	r.mu.Lock()
+	delete(r.results, id)
+	delete(r.cancels, id)
+	r.mu.Unlock()
+}
+
+// cancel снимает выражение с учета и будит его calc
+// false - выражение сейчас не считается
+func (r *registry) cancel(id int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancelled, ok := r.cancels[id]
+	if !ok {
+		return false
+	}
+	// с этого момента результаты выражения опаздывают, а его задачи не отправляются агентам
+	delete(r.results, id)
+	delete(r.cancels, id)
+	close(cancelled)
+	return true
+}
 
-	chans := channels{
-		tasks:   &tasks,
-		results: &results,
+// cancelExpression останавливает выражение: оставшиеся узлы не отправляются,
+// а агенты, которым уже отданы его задачи, получают отмену
+func cancelExpression(id int) {
+	if !exprs.cancel(id) {
+		return
 	}
-	managerCh <- chans
+	agents.notify(leases.cancel(id), id)
+}
 
+func NewExpression(id int, node *models.AstNode) *expression {
 	return &expression{
+		id:        id,
 		node:      node,
-		tasks:     tasks,
-		results:   results,
 		currTasks: make(map[int]*models.AstNode),
+		keys:      make(map[int]string),
 	}
 }
 
-func (e *expression) calc() (float64, error) {
+// withPrecision задает режим чисел, по умолчанию выражение считается во float64
+func (e *expression) withPrecision(precision models.Precision) *expression {
+	e.precision = precision
+	return e
+}
+
+// withDeadline задает срок вычисления, нулевой - считать без срока
+func (e *expression) withDeadline(deadline time.Time) *expression {
+	e.deadline = deadline
+	return e
+}
+
+// withOwner задает пользователя и класс приоритета, по которым задачи выражения встают в очередь
+func (e *expression) withOwner(user int, priority string) *expression {
+	e.user = user
+	e.priority = priority
+	return e
+}
+
+// withCache подключает кэш результатов задач, nil - считать без кэша
+func (e *expression) withCache(c *cache.Cache) *expression {
+	e.cache = c
+	return e
+}
+
+// exact возвращает точный результат посчитанного выражения в точных режимах
+// корень мог стать числом без агента (литерал, выбранная ветвь условия, кэш): 1e-9 или 0.125 при scale 2
+// записываются так же, как результат агента - по правилам режима
+func (e *expression) exact() string {
+	if e.precision.Mode != models.ModeDecimal && e.precision.Mode != models.ModeRational {
+		return ""
+	}
+	x, err := decimal.Parse(e.node.Value)
+	if err != nil {
+		return e.node.Value
+	}
+	return decimal.FromPrecision(e.precision).Format(x)
+}
+
+// fraction - результат режима rational в виде дроби, в остальных режимах nil
+func (e *expression) fraction() *big.Rat {
+	if e.precision.Mode != models.ModeRational {
+		return nil
+	}
+	x, err := decimal.Parse(e.node.Value)
+	if err != nil {
+		return nil
+	}
+	return x
+}
+
+// evaluate считает выражение и проводит его по статусам processing -> done/error/timeout
+// отмененное выражение остается cancelled: статус записывает тот, кто отменил
+func evaluate(db *database.DB, e *expression) {
+	ctx := context.Background()
+	id := e.id
+	if err := db.UpdateExpressionStatus(ctx, id, models.StatusProcessing); err != nil {
+		log.Printf("expression %d: %v", id, err)
+	}
+	// результат выражения записан в expressions, его задачи больше не нужны
+	defer func() {
+		if err := db.DeleteTasks(ctx, id); err != nil {
+			log.Printf("expression %d: %v", id, err)
+		}
+	}()
+
+	result, err := e.calc()
+	// статус cancelled уже записан тем, кто отменил выражение
+	if errors.Is(err, models.ErrCancelled) {
+		log.Printf("expression %d cancelled", id)
+		return
+	}
+	if errors.Is(err, models.ErrTimeout) {
+		log.Printf("expression %d: %v", id, err)
+		if err := db.ExpireExpression(ctx, id, err.Error()); err != nil {
+			log.Printf("expression %d: %v", id, err)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("expression %d failed: %v", id, err)
+		if err := db.FailExpression(ctx, id, err.Error()); err != nil {
+			log.Printf("expression %d: %v", id, err)
+		}
+		return
+	}
+
+	if err := db.UpdateExpression(ctx, id, models.StatusDone, result, e.exact(), e.fraction()); err != nil {
+		log.Printf("expression %d: %v", id, err)
+	}
+	log.Printf("expression %d calculated: %v", id, result)
+}
+
+// register ставит выражение на учет: с этого момента его можно отменить
+func (e *expression) register() {
 	e.fillMap(e.node)
-	var result float64
+	e.results, e.cancelled = exprs.register(e.id, len(e.currTasks))
+}
+
+// start регистрирует выражение до запуска горутины, иначе отмена, пришедшая раньше регистрации,
+// не находит выражение, а calc затем отправляет все его задачи
+func start(db *database.DB, e *expression) {
+	e.register()
+	go evaluate(db, e)
+}
+
+func (e *expression) calc() (float64, error) {
+	if e.results == nil {
+		e.register()
+	}
+	defer exprs.unregister(e.id)
+	// посчитанному, отмененному или просроченному выражению его задачи в очереди не нужны
+	defer sched.remove(e.id)
+
+	e.ctx = context.Background()
+	if !e.deadline.IsZero() {
+		var cancel context.CancelFunc
+		e.ctx, cancel = context.WithDeadline(e.ctx, e.deadline)
+		defer cancel()
+	}
+
 	for {
 		// проходимся по дереву и находим ноды, у которых оба листка - числа
-		sendTasks(e.node, e.tasks, e.currTasks)
+		e.sendTasks(e.node)
 
-		select {
-		case res := <-e.results:
-			if res.Error != "" {
-				// очищаем каналы
-				close(e.tasks)
-				close(e.results)
-
-				log.Printf("id: %v, res: %v, err: %v", res.ID, res.Result, res.Error)
-				return 0, errors.New(res.Error)
-			}
-
-			result = e.deleteAndUpdate(res)
-			log.Println("Updated tree with new result")
-		default:
-			if len(e.currTasks) == 0 {
-				return result, nil
-			}
-			time.Sleep(10 * time.Millisecond) // избегаем busy loop
+		// корень стал числом - выражение посчитано
+		// выражение из одного числа или с известным условием может не требовать задач для агента
+		if e.node.AstType == "number" {
+			return e.approx()
+		}
+		if err := e.interrupted(); err != nil {
+			return 0, err
 		}
 
-		// если все задачи удалены - результат получен, а значит можно завершать функцию
-		if len(e.currTasks) == 0 {
-			close(e.tasks)
-			close(e.results)
-			return result, nil
+		var res models.Result
+		select {
+		case res = <-e.results:
+		case <-e.cancelled:
+			return 0, models.ErrCancelled
+		case <-e.ctx.Done():
+			return 0, models.ErrTimeout
+		}
+		// опоздавший результат узла, который уже посчитан или забыт: ошибка исчерпанных попыток,
+		// пришедшая после успешного ответа, не должна портить выражение
+		if !e.pending(res.ID) {
+			log.Printf("dropping stale result for node %d of expression %d", res.ID, e.id)
+			continue
+		}
+		e.finish(res)
+		if res.Error != "" {
+			log.Printf("expression: %v, id: %v, res: %v, err: %v", e.id, res.ID, res.Result, res.Error)
+			return 0, errors.New(res.Error)
 		}
+
+		e.remember(res)
+		e.deleteAndUpdate(res)
+		log.Println("Updated tree with new result")
 	}
 }
 
-func sendTasks(node *models.AstNode, tasks chan<- *models.AstNode, currTasks map[int]*models.AstNode) {
+func (e *expression) sendTasks(node *models.AstNode) {
 	if node == nil {
 		return
 	}
@@ -135,18 +316,179 @@ func sendTasks(node *models.AstNode, tasks chan<- *models.AstNode, currTasks map
 		return
 	}
 
+	// ленивые узлы: пока не известно условие, ветви агентам не отправляются
+	if node.AstType == "conditional" {
+		cond := node.Args[0]
+		e.sendTasks(cond)
+		if cond.AstType != "number" {
+			return
+		}
+
+		// узел заменяется выбранной ветвью, мертвая ветвь не считается вовсе
+		taken, dead := node.Args[1], node.Args[2]
+		if !calculator.Truthy(cond.Value) {
+			taken, dead = dead, taken
+		}
+		e.forget(cond)
+		e.forget(dead)
+		delete(e.currTasks, taken.ID)
+
+		id := node.ID
+		*node = *taken
+		node.ID = id
+		e.sendTasks(node)
+		return
+	}
+
+	if node.Value == "&&" || node.Value == "||" {
+		e.sendTasks(node.Left)
+		if node.Left.AstType != "number" {
+			return
+		}
+
+		// левый операнд уже решает результат: 0 && x = 0, 1 || x = 1
+		if calculator.Truthy(node.Left.Value) == (node.Value == "||") {
+			e.forget(node.Left)
+			e.forget(node.Right)
+			node.AstType = "number"
+			node.Value = boolValue(node.Value == "||")
+			node.Left = nil
+			node.Right = nil
+			return
+		}
+	}
+
+	// пост-ордер: сначала листья, ленивые узлы среди них могут сразу стать числами
+	e.sendTasks(node.Left)
+	e.sendTasks(node.Right)
+	for _, arg := range node.Args {
+		e.sendTasks(arg)
+	}
+
 	// проверяем, что узел не обработан, а его листья - числа
-	if node.Left != nil && node.Right != nil &&
-		node.Left.AstType == "number" && node.Right.AstType == "number" {
-		if node, exists := currTasks[node.ID]; exists && !node.Counting {
+	if ready(node) {
+		if node, exists := e.currTasks[node.ID]; exists && !node.Counting {
+			// результат из кэша сразу превращает узел в число, родитель может стать готовым в этом же проходе
+			if e.recover(node) || e.cached(node) {
+				return
+			}
 			node.Counting = true
-			tasks <- node
+			e.queue(node)
+			sched.push(task{
+				exprID:    e.id,
+				node:      node,
+				precision: e.precision,
+				deadline:  e.deadline,
+				user:      e.user,
+				priority:  e.priority,
+				db:        e.db,
+			})
+		}
+	}
+}
+
+// interrupted - почему выражение больше не считается: отмена или срок; nil - считается
+func (e *expression) interrupted() error {
+	select {
+	case <-e.cancelled:
+		return models.ErrCancelled
+	default:
+	}
+	if e.ctx.Err() != nil {
+		return models.ErrTimeout
+	}
+	return nil
+}
+
+// cached ищет результат узла в кэше и, если он есть, подставляет его вместо задачи
+func (e *expression) cached(node *models.AstNode) bool {
+	if e.cache == nil {
+		return false
+	}
+
+	key := cache.Key(e.precision, node.Value, operands(node))
+	entry, ok := e.cache.Get(context.Background(), key)
+	if !ok {
+		e.keys[node.ID] = key
+		return false
+	}
+
+	e.deleteAndUpdate(models.Result{ID: node.ID, ExpressionID: e.id, Result: entry.Result, Value: entry.Value})
+	return true
+}
+
+// remember сохраняет результат задачи в кэш; ошибки не кэшируются
+func (e *expression) remember(res models.Result) {
+	key, ok := e.keys[res.ID]
+	if e.cache == nil || !ok || res.Error != "" {
+		return
+	}
+	delete(e.keys, res.ID)
+	e.cache.Put(context.Background(), key, cache.Entry{Result: res.Result, Value: res.Value})
+}
+
+// operands - значения листьев готового узла в порядке аргументов
+func operands(node *models.AstNode) []string {
+	if node.AstType == "function" {
+		args := make([]string, len(node.Args))
+		for i, arg := range node.Args {
+			args[i] = arg.Value
 		}
+		return args
 	}
 
-	// пост-ордер для отправки всех готовых тасков агенту
-	sendTasks(node.Left, tasks, currTasks)
-	sendTasks(node.Right, tasks, currTasks)
+	args := []string{node.Left.Value}
+	if node.Right != nil {
+		args = append(args, node.Right.Value)
+	}
+	return args
+}
+
+// forget убирает поддерево из ожидаемых задач
+func (e *expression) forget(node *models.AstNode) {
+	if node == nil {
+		return
+	}
+
+	delete(e.currTasks, node.ID)
+	e.forget(node.Left)
+	e.forget(node.Right)
+	for _, arg := range node.Args {
+		e.forget(arg)
+	}
+}
+
+// approx - результат выражения во float64
+// точное значение за пределами float64 приближения не имеет, тогда результат - 0
+func (e *expression) approx() (float64, error) {
+	if exact := e.exact(); exact != "" {
+		return decimal.Approx(exact), nil
+	}
+	return strconv.ParseFloat(e.node.Value, 64)
+}
+
+func boolValue(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// узел готов к вычислению, если все его листья - числа (у унарного узла лист один)
+func ready(node *models.AstNode) bool {
+	if node.AstType == "function" {
+		for _, arg := range node.Args {
+			if arg.AstType != "number" {
+				return false
+			}
+		}
+		return true
+	}
+
+	if node.Left == nil || node.Left.AstType != "number" {
+		return false
+	}
+	return node.Right == nil || node.Right.AstType == "number"
 }
 
 func (e *expression) fillMap(node *models.AstNode) {
@@ -155,43 +497,50 @@ func (e *expression) fillMap(node *models.AstNode) {
 	}
 
 	// заполняем мапу, где ключ - айди ноды, а значение - сама нода
-	mu.Lock()
 	e.currTasks[node.ID] = node
-	mu.Unlock()
 
 	// обходим дерево методом пост-ордера
 	e.fillMap(node.Left)
 	e.fillMap(node.Right)
+	for _, arg := range node.Args {
+		e.fillMap(arg)
+	}
+}
+
+// pending - ждет ли узел результата агента
+func (e *expression) pending(id int) bool {
+	node, ok := e.currTasks[id]
+	return ok && node.Counting && node.AstType != "number"
 }
 
-func (e *expression) deleteAndUpdate(res models.Result) float64 {
+func (e *expression) deleteAndUpdate(res models.Result) {
 	// когда мы получаем результат ноды, мы удаляем ее листья, а потом меняем ноду на число для дальнейших вычислений
 	// так как мапа ссылается на ноду, то, взаимодействуя с элементом мапы, мы напрямую взаимодействуем с нодой
 
 	// проверяем, можно ли обращаться к листьям ноды для их удаления
 	node, exists := e.currTasks[res.ID]
-	if !exists || node.Left == nil || node.Right == nil {
-		return 0
+	if !exists || (node.Left == nil && node.Args == nil) {
+		return
 	}
 
-	left := node.Left.ID
-	right := node.Right.ID
-
-	delete(e.currTasks, left)
-	delete(e.currTasks, right)
+	if node.Left != nil {
+		delete(e.currTasks, node.Left.ID)
+	}
+	if node.Right != nil {
+		delete(e.currTasks, node.Right.ID)
+	}
+	for _, arg := range node.Args {
+		delete(e.currTasks, arg.ID)
+	}
 
-	node.Value = fmt.Sprintf("%f", res.Result)
+	// кратчайшая запись, которая читается обратно в то же float64: 1e+20, 3.0000000000000004e-07
+	node.Value = strconv.FormatFloat(res.Result, 'g', -1, 64)
+	if res.Value != "" {
+		node.Value = res.Value // точное значение не проходит через float64
+	}
 	node.AstType = "number"
 	node.Left = nil
 	node.Right = nil
+	node.Args = nil
 	log.Printf("Updated node with id %d", node.ID)
-
-	// простая обработка финального значения выражения
-	if len(e.currTasks) == 1 {
-		result, _ := strconv.ParseFloat(node.Value, 64)
-		delete(e.currTasks, res.ID)
-		return result
-	}
-
-	return 0
 }
@@ -0,0 +1,498 @@
+package orchestrator
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"calculator/internal/cache"
+	"calculator/pkg/ast"
+	"calculator/pkg/calculator"
+	"calculator/pkg/decimal"
+	"calculator/pkg/functions"
+	"calculator/pkg/models"
+	"calculator/pkg/optimizer"
+)
+
+var (
+	startOnce sync.Once
+	fakePause = make(chan chan struct{})
+)
+
+// fakeAgent заменяет агента: забирает задачи из tasksCh и сразу возвращает результат
+func fakeAgent() {
+	startOnce.Do(func() {
+		StartManager()
+		go func() {
+			for {
+				var t task
+				select {
+				case t = <-tasksCh:
+				case resume := <-fakePause:
+					<-resume
+					continue
+				}
+
+				if t.precision.Mode != "" && t.precision.Mode != models.ModeFloat {
+					resultsCh <- exactResult(t)
+					continue
+				}
+				resultsCh <- floatResult(t)
+			}
+		}()
+	})
+}
+
+// pauseFakeAgent останавливает fakeAgent, чтобы задачи забирал настоящий агент;
+// возвращает функцию, которая запускает его снова
+func pauseFakeAgent() func() {
+	fakeAgent()
+	resume := make(chan struct{})
+	fakePause <- resume
+	return func() { close(resume) }
+}
+
+// floatResult считает задачу режима float теми же операторами и функциями, что и агент
+func floatResult(t task) models.Result {
+	res := models.Result{ID: t.node.ID, ExpressionID: t.exprID}
+
+	var err error
+	if t.node.AstType == "function" {
+		args := make([]float64, len(t.node.Args))
+		for i, arg := range t.node.Args {
+			args[i], _ = strconv.ParseFloat(arg.Value, 64)
+		}
+		res.Result, err = functions.Call(t.node.Value, args)
+	} else {
+		a, _ := strconv.ParseFloat(t.node.Left.Value, 64)
+		var b float64
+		if t.node.Right != nil {
+			b, _ = strconv.ParseFloat(t.node.Right.Value, 64)
+		}
+		res.Result, err = calculator.Apply(t.node.Value, a, b)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
+
+// exactResult считает задачу точного режима так же, как агент
+func exactResult(t task) models.Result {
+	ctx := decimal.FromPrecision(t.precision)
+	res := models.Result{ID: t.node.ID, ExpressionID: t.exprID}
+
+	var err error
+	if t.node.AstType == "function" {
+		args := make([]string, len(t.node.Args))
+		for i, arg := range t.node.Args {
+			args[i] = arg.Value
+		}
+		res.Value, err = ctx.Call(t.node.Value, args)
+	} else {
+		b := ""
+		if t.node.Right != nil {
+			b = t.node.Right.Value
+		}
+		res.Value, err = ctx.Calculate(t.node.Value, t.node.Left.Value, b)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	res.Result = decimal.Approx(res.Value)
+	return res
+}
+
+func TestCalc(t *testing.T) {
+	fakeAgent()
+
+	tests := []struct {
+		expression string
+		expected   float64
+		wantErr    bool
+	}{
+		{"2+2*2", 6, false},
+		{"(1+2)*(3+4)", 21, false},
+		{"123", 123, false},
+		{"-3+5", 2, false},
+		{"2*(-4)", -8, false},
+		{"(-(2+3))", -5, false},
+		{"--3*+2", 6, false},
+		{"2^3^2", 512, false},
+		{"-2^2", -4, false},
+		{"2**-1*4", 2, false},
+		{"(1+0.5)^2*2", 4.5, false},
+		{"sqrt(16)+max(1,2*3,-4)", 10, false},
+		{"round(abs(-2.5))*min(2,3)", 6, false},
+		{"7//2+7%4", 6, false},
+		{"3!^2-2*3!", 24, false},
+		{"-3!", -6, false},
+		{"(1+2)!!", 720, false},
+		{"1+2<3*4", 1, false},
+		{"!(2>=3)&&1!=2", 1, false},
+		{"2>3||2==3", 0, false},
+		{"5>3?10:20", 10, false},
+		{"if(5<3, 10, 20)+1", 21, false},
+		{"1?2?3:4:5", 3, false},
+		// мертвая ветвь не отправляется агенту, поэтому ее ошибка не мешает
+		{"1>2?1/(1-1):5", 5, false},
+		{"if(1, 7, sqrt(-1))", 7, false},
+		{"0&&1/(1-1)", 0, false},
+		{"2||sqrt(-1)", 1, false},
+		{"1&&3>2", 1, false},
+		// промежуточные значения не должны терять точность
+		{"1e20+1", 1e20, false},
+		{"0.0000001*3", 3e-07, false},
+		{"0.1+0.2-0.3", 5.551115123125783e-17, false},
+		{"2^53+1-2^53", 0, false},
+		{"123456789.123456789*1000", 123456789123.45679, false},
+		{"1<2?1/(1-1):5", 0, true},
+		{"sqrt(1-2)", 0, true},
+		{"1/(2-2)", 0, true},
+		// операторы те же, что у агента: знак остатка, ошибки факториала и переполнения
+		{"-7%3", 2, false},
+		{"(1+1.5)!", 0, true},
+		{"(0-1)!", 0, true},
+		{"1e308*(5+5)", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			node, err := ast.Build(tt.expression)
+			if err != nil {
+				t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+			}
+
+			result, err := NewExpression(1, node).calc()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("calc(%s) error = %v, wantErr %v", tt.expression, err, tt.wantErr)
+			}
+			if !tt.wantErr && result != tt.expected {
+				t.Errorf("calc(%s) = %v, expected %v", tt.expression, result, tt.expected)
+			}
+		})
+	}
+}
+
+// выражения строятся независимо, поэтому id их узлов совпадают;
+// результаты все равно должны доходить до своего выражения
+func TestCalcConcurrent(t *testing.T) {
+	fakeAgent()
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			expression := strconv.Itoa(id) + "*2+(1+1)"
+			node, err := ast.Build(expression)
+			if err != nil {
+				t.Errorf("ast.Build(%s) error: %v", expression, err)
+				return
+			}
+
+			result, err := NewExpression(id, node).calc()
+			if err != nil {
+				t.Errorf("calc(%s) error: %v", expression, err)
+				return
+			}
+			if expected := float64(id*2 + 2); result != expected {
+				t.Errorf("calc(%s) = %v, expected %v", expression, result, expected)
+			}
+		}(i + 1)
+	}
+	wg.Wait()
+}
+
+func TestCalcDecimal(t *testing.T) {
+	fakeAgent()
+
+	tests := []struct {
+		expression string
+		scale      int
+		rounding   decimal.Rounding
+		expected   string
+	}{
+		{"0.1+0.2", 20, decimal.HalfEven, "0.3"},
+		{"0.1+0.2==0.3", 20, decimal.HalfEven, "1"},
+		{"1/3*3", 20, decimal.HalfEven, "0.99999999999999999999"},
+		{"2/3", 2, decimal.HalfUp, "0.67"},
+		{"2/3", 2, decimal.Down, "0.66"},
+		{"1e20+1", 20, decimal.HalfEven, "100000000000000000001"},
+		{"0.0000001*3", 20, decimal.HalfEven, "0.0000003"},
+		{"round(1.005, 2)+sqrt(0.25)", 20, decimal.HalfEven, "1.51"},
+		{"7.50+0", 20, decimal.HalfEven, "7.5"},
+		// корень стал числом без агента, но записан по правилам режима
+		{"1e-9", 20, decimal.HalfEven, "0.000000001"},
+		{"0x1F", 20, decimal.HalfEven, "31"},
+		{"0.125", 2, decimal.HalfEven, "0.12"},
+		{"1>0 ? 0.125 : 1", 2, decimal.HalfUp, "0.13"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			node, err := ast.Build(tt.expression)
+			if err != nil {
+				t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+			}
+
+			precision := models.Precision{Mode: models.ModeDecimal, Scale: tt.scale, Rounding: string(tt.rounding)}
+			e := NewExpression(1, node).withPrecision(precision)
+			if _, err := e.calc(); err != nil {
+				t.Fatalf("calc(%s) error: %v", tt.expression, err)
+			}
+			if got := e.exact(); got != tt.expected {
+				t.Errorf("calc(%s) = %s, expected %s", tt.expression, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCalcRational(t *testing.T) {
+	fakeAgent()
+
+	tests := []struct {
+		expression string
+		expected   string
+		approx     float64
+	}{
+		{"1/3+1/6", "1/2", 0.5},
+		{"0.1+0.2", "3/10", 0.3},
+		{"1/3*3", "1", 1},
+		{"(1/3)^2-1/9", "0", 0},
+		{"1/3>0.333 ? 1/7 : 0", "1/7", 1.0 / 7},
+		{"1/3-1/3 ? 1 : 0.5", "1/2", 0.5},
+		{"sqrt(1/4)+2/3", "7/6", 7.0 / 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			node, err := ast.Build(tt.expression)
+			if err != nil {
+				t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+			}
+
+			e := NewExpression(1, node).withPrecision(models.Precision{Mode: models.ModeRational})
+			result, err := e.calc()
+			if err != nil {
+				t.Fatalf("calc(%s) error: %v", tt.expression, err)
+			}
+			if got := e.exact(); got != tt.expected || result != tt.approx {
+				t.Errorf("calc(%s) = %s (%v), expected %s (%v)", tt.expression, got, result, tt.expected, tt.approx)
+			}
+			if f := e.fraction(); f == nil || f.RatString() != tt.expected {
+				t.Errorf("fraction(%s) = %v, expected %s", tt.expression, f, tt.expected)
+			}
+		})
+	}
+}
+
+// после оптимизатора дерево - DAG: общий узел считается один раз и не мешает ленивым ветвям
+func TestCalcOptimized(t *testing.T) {
+	fakeAgent()
+
+	policy := optimizer.Policy{Fold: optimizer.FoldNone, Identities: true, Dedupe: true}
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"(1+2)*(1+2)", 9},
+		{"sqrt(16)+sqrt(16)*sqrt(16)", 20},
+		{"(sqrt(4)>1 ? sqrt(9) : sqrt(9)+1)*sqrt(9)", 9},
+		{"(sqrt(4)>3 ? 1 : 2)+(sqrt(4)>3 ? 1 : 2)", 4},
+		{"sqrt(4)>1 && sqrt(4)>1", 1},
+		{"sqrt(4)<1 && sqrt(4)<1", 0},
+		{"0*(sqrt(4)+1)+sqrt(4)*1", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			node, err := ast.Build(tt.expression)
+			if err != nil {
+				t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+			}
+
+			root := optimizer.Optimize(node, policy, models.Precision{Mode: models.ModeFloat})
+			result, err := calcTimeout(t, NewExpression(1, root))
+			if err != nil {
+				t.Fatalf("calc(%s) error: %v", tt.expression, err)
+			}
+			if result != tt.expected {
+				t.Errorf("calc(%s) = %v, expected %v", tt.expression, result, tt.expected)
+			}
+		})
+	}
+}
+
+// повторное выражение целиком берется из кэша: задачи агенту не уходят
+func TestCalcCached(t *testing.T) {
+	fakeAgent()
+
+	c := cache.New(100, nil)
+	rational := models.Precision{Mode: models.ModeRational}
+	tests := []struct {
+		expression string
+		precision  models.Precision
+		expected   float64
+		tasks      int64 // задач в первом вычислении
+	}{
+		{"(1+2)*sqrt(16)-2^3", models.Precision{}, 4, 5},
+		{"sqrt(4)>1 ? max(1, 2, 3) : 1/(1-1)", models.Precision{}, 3, 3},
+		{"1/3+1/6", rational, 0.5, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			build := func() *expression {
+				node, err := ast.Build(tt.expression)
+				if err != nil {
+					t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+				}
+				return NewExpression(1, node).withPrecision(tt.precision).withCache(c)
+			}
+
+			before := c.Stats()
+			if result, err := calcTimeout(t, build()); err != nil || result != tt.expected {
+				t.Fatalf("calc(%s) = %v, %v; expected %v", tt.expression, result, err, tt.expected)
+			}
+			if misses := c.Stats().Misses - before.Misses; misses != tt.tasks {
+				t.Errorf("calc(%s) missed %d times, expected %d", tt.expression, misses, tt.tasks)
+			}
+
+			// без агента выражение досчитается, только если все задачи найдутся в кэше
+			resume := pauseFakeAgent()
+			defer resume()
+
+			before = c.Stats()
+			if result, err := calcTimeout(t, build()); err != nil || result != tt.expected {
+				t.Fatalf("cached calc(%s) = %v, %v; expected %v", tt.expression, result, err, tt.expected)
+			}
+			if hits := c.Stats().Hits - before.Hits; hits != tt.tasks {
+				t.Errorf("cached calc(%s) hit %d times, expected %d", tt.expression, hits, tt.tasks)
+			}
+		})
+	}
+}
+
+// ошибки не кэшируются: задача с ошибкой уходит агенту снова
+func TestCalcCachedError(t *testing.T) {
+	fakeAgent()
+
+	c := cache.New(100, nil)
+	for range 2 {
+		node, err := ast.Build("1/(1-1)")
+		if err != nil {
+			t.Fatalf("ast.Build error: %v", err)
+		}
+		if _, err := calcTimeout(t, NewExpression(1, node).withCache(c)); err == nil {
+			t.Fatal("calc(1/(1-1)) expected division by zero")
+		}
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 3 {
+		t.Errorf("stats = %+v, expected 1 hit (1-1) and 3 misses", stats)
+	}
+}
+
+// отмена прерывает выражение, которое ждет агента, и снимает его с учета
+func TestCalcCancelled(t *testing.T) {
+	resume := pauseFakeAgent()
+	defer resume()
+
+	node, err := ast.Build("(1+2)*3")
+	if err != nil {
+		t.Fatalf("ast.Build error: %v", err)
+	}
+	e := NewExpression(300, node)
+
+	go func() {
+		for !exprs.active(e.id) {
+			time.Sleep(time.Millisecond)
+		}
+		cancelExpression(e.id)
+	}()
+
+	if _, err := calcTimeout(t, e); !errors.Is(err, models.ErrCancelled) {
+		t.Errorf("calc = %v; expected %v", err, models.ErrCancelled)
+	}
+	if exprs.active(e.id) || exprs.cancel(e.id) {
+		t.Error("cancelled expression is still registered")
+	}
+}
+
+// отмена сразу после регистрации, раньше запуска calc, не теряется
+func TestCalcCancelledBeforeStart(t *testing.T) {
+	resume := pauseFakeAgent()
+	defer resume()
+
+	node, err := ast.Build("(1+2)*3")
+	if err != nil {
+		t.Fatalf("ast.Build error: %v", err)
+	}
+	e := NewExpression(301, node)
+	e.register()
+	cancelExpression(e.id)
+
+	if _, err := calcTimeout(t, e); !errors.Is(err, models.ErrCancelled) {
+		t.Errorf("calc = %v; expected %v", err, models.ErrCancelled)
+	}
+	if exprs.active(e.id) {
+		t.Error("cancelled expression is still registered")
+	}
+}
+
+// ошибка узла, пришедшая после его результата, выражение не портит
+func TestCalcStaleError(t *testing.T) {
+	resume := pauseFakeAgent()
+	defer resume()
+
+	node, err := ast.Build("(1+2)*3")
+	if err != nil {
+		t.Fatalf("ast.Build error: %v", err)
+	}
+	e := NewExpression(302, node)
+	e.register()
+	// (1+2)*3: + - 2, * - 4
+	e.results <- models.Result{ID: 2, ExpressionID: e.id, Result: 3}
+	e.results <- models.Result{ID: 2, ExpressionID: e.id, Error: "task 2 failed after 3 attempts: agent disconnected"}
+	e.results <- models.Result{ID: 4, ExpressionID: e.id, Result: 9}
+
+	if result, err := calcTimeout(t, e); err != nil || result != 9 {
+		t.Errorf("calc = %v, %v; expected 9", result, err)
+	}
+}
+
+// срок прерывает выражение, которое ждет агента; посчитанное выражение срок не портит
+func TestCalcDeadline(t *testing.T) {
+	tests := []struct {
+		name      string
+		deadline  time.Duration // от начала теста
+		recovered []models.Result
+		err       error
+	}{
+		{"expires while waiting", 50 * time.Millisecond, nil, models.ErrTimeout},
+		{"already expired", -time.Second, nil, models.ErrTimeout},
+		// (1+2)*3: + - 2, * - 4
+		{"finished before the check", -time.Second, []models.Result{{ID: 2, Result: 3}, {ID: 4, Result: 9}}, nil},
+	}
+
+	resume := pauseFakeAgent()
+	defer resume()
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := ast.Build("(1+2)*3")
+			if err != nil {
+				t.Fatalf("ast.Build error: %v", err)
+			}
+			e := NewExpression(310+i, node).withDeadline(time.Now().Add(tt.deadline)).withRecovered(tt.recovered)
+
+			if _, err := calcTimeout(t, e); !errors.Is(err, tt.err) {
+				t.Errorf("calc = %v; expected %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -2,14 +2,18 @@ package orchestrator
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
-	pb "calculator/api/gen/go"
+	pb "calculator/api/gen/go/v2"
 	"calculator/pkg/models"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
 )
 
 const (
@@ -26,11 +30,67 @@ func NewServer() *Server {
 	return &Server{mu: sync.Mutex{}}
 }
 
+// номер потока агента: с одного адреса может прийти несколько агентов или переподключение
+var streams atomic.Int64
+
+// отмен, ожидающих отправки одному агенту; больше бывает, только если агент не читает поток
+const cancelBuffer = 16
+
+var agents = hub{cancels: make(map[string]chan int)}
+
+// hub хранит каналы отмен подключенных агентов по имени
+type hub struct {
+	mu      sync.Mutex
+	cancels map[string]chan int
+}
+
+func (h *hub) connect(agent string) <-chan int {
+	ch := make(chan int, cancelBuffer)
+	h.mu.Lock()
+	h.cancels[agent] = ch
+	h.mu.Unlock()
+	return ch
+}
+
+func (h *hub) disconnect(agent string) {
+	h.mu.Lock()
+	delete(h.cancels, agent)
+	h.mu.Unlock()
+}
+
+// notify отправляет агентам отмену выражения
+// отмена, которую агент не успевает принять, пропускается: его результаты по выражению все равно отбрасываются
+func (h *hub) notify(names []string, exprID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, name := range names {
+		ch, ok := h.cancels[name]
+		if !ok {
+			continue
+		}
+		select {
+		case ch <- exprID:
+		default:
+			log.Printf("dropping cancellation of expression %d for %s", exprID, name)
+		}
+	}
+}
+
 func (s *Server) Calculate(stream pb.Orchestrator_CalculateServer) error {
-	log.Println("agent connected to gRPC server")
-	defer log.Println("agent disconnected")
+	n := streams.Add(1)
+	agent := fmt.Sprintf("agent#%d", n)
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		agent = fmt.Sprintf("%s#%d", p.Addr, n)
+	}
+	log.Printf("%s connected to gRPC server", agent)
+	defer log.Printf("%s disconnected", agent)
 	ctx, cancel := context.WithCancel(stream.Context())
 	defer cancel()
+	// задачи, которые агент получил, но не вернул, уходят другим агентам
+	defer leases.revoke(agent)
+	cancels := agents.connect(agent)
+	defer agents.disconnect(agent)
 
 	done := make(chan struct{})
 	defer close(done)
@@ -40,19 +100,41 @@ func (s *Server) Calculate(stream pb.Orchestrator_CalculateServer) error {
 		for {
 			select {
 			case task := <-tasksCh:
+				// выражение отменили, пока задача ждала агента
+				if !exprs.active(task.exprID) {
+					continue
+				}
+				req := task.req
+				if req == nil {
+					req = taskRequest(task)
+				}
+				// остаток срока считается при каждой отправке: повторно задача уходит с меньшим запасом
+				if !task.deadline.IsZero() {
+					budget := time.Until(task.deadline).Milliseconds()
+					if budget <= 0 {
+						continue
+					}
+					req.BudgetMs = budget
+				}
+				leases.grant(task, req, agent)
+
 				s.mu.Lock()
-				err := stream.Send(&pb.TaskRequest{
-					Id:       int32(task.ID),
-					Arg1:     task.Left.Value,
-					Arg2:     task.Right.Value,
-					Operator: task.Value,
-				})
+				err := stream.Send(req)
 				s.mu.Unlock()
 
 				if err != nil {
 					log.Printf("Failed to send task: %v", err)
 					return
 				}
+			case exprID := <-cancels:
+				s.mu.Lock()
+				err := stream.Send(&pb.TaskRequest{ExpressionId: int32(exprID), Cancel: true})
+				s.mu.Unlock()
+
+				if err != nil {
+					log.Printf("Failed to send cancellation: %v", err)
+					return
+				}
 			case <-ctx.Done():
 				return
 			case <-done:
@@ -73,10 +155,13 @@ func (s *Server) Calculate(stream pb.Orchestrator_CalculateServer) error {
 					log.Printf("Receive error: %v", err)
 					return
 				}
+				leases.release(int(res.ExpressionId), int(res.Id))
 				resultsCh <- models.Result{
-					ID:     int(res.Id),
-					Result: float64(res.Result),
-					Error:  res.Error,
+					ID:           int(res.Id),
+					ExpressionID: int(res.ExpressionId),
+					Result:       res.Result,
+					Value:        res.Value,
+					Error:        res.Error,
 				}
 			}
 		}
@@ -86,6 +171,33 @@ func (s *Server) Calculate(stream pb.Orchestrator_CalculateServer) error {
 	return nil
 }
 
+// taskRequest переводит готовый узел дерева в задачу для агента
+func taskRequest(t task) *pb.TaskRequest {
+	task := t.node
+	req := &pb.TaskRequest{
+		Id:           int32(task.ID),
+		ExpressionId: int32(t.exprID),
+		Operator:     task.Value,
+		Mode:         t.precision.Mode,
+		Scale:        int32(t.precision.Scale),
+		Rounding:     t.precision.Rounding,
+	}
+
+	if task.AstType == "function" {
+		for _, arg := range task.Args {
+			req.Args = append(req.Args, arg.Value)
+		}
+		return req
+	}
+
+	req.Arg1 = task.Left.Value
+	// у унарного оператора второго аргумента нет
+	if task.Right != nil {
+		req.Arg2 = task.Right.Value
+	}
+	return req
+}
+
 func runGRPC() {
 	log.Println("Starting tcp server...")
 
@@ -2,11 +2,18 @@ package orchestrator
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net"
 	"testing"
 	"time"
 
-	pb "calculator/api/gen/go"
+	pb "calculator/api/gen/go/v2"
+	"calculator/internal/agent"
+	"calculator/pkg/ast"
+	"calculator/pkg/calculator"
+	"calculator/pkg/config"
+	"calculator/pkg/models"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -83,3 +90,277 @@ func TestOrchestratorGRPC(t *testing.T) {
 		}
 	})
 }
+
+// startAgent запускает gRPC-сервер и подключает к нему настоящего агента вместо fakeAgent
+func startAgent(t *testing.T) {
+	resume := pauseFakeAgent()
+	t.Cleanup(resume)
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	srv := grpc.NewServer()
+	pb.RegisterOrchestratorServer(srv, NewServer())
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	t.Setenv("ORCHESTRATOR_GRPS_URL", lis.Addr().String())
+	go agent.New(config.Config{AgentComputingPower: 2}).Run()
+}
+
+func TestHubNotify(t *testing.T) {
+	h := hub{cancels: make(map[string]chan int)}
+	a := h.connect("a")
+	b := h.connect("b")
+	h.disconnect("b")
+
+	// отключившийся и неизвестный агенты пропускаются
+	h.notify([]string{"a", "b", "c"}, 7)
+	if got := <-a; got != 7 {
+		t.Errorf("agent a got cancellation of %d, expected 7", got)
+	}
+	if len(b) != 0 {
+		t.Error("disconnected agent b got a cancellation")
+	}
+
+	// переполненный канал не блокирует отмену
+	for i := range cancelBuffer + 1 {
+		h.notify([]string{"a"}, i)
+	}
+	if len(a) != cancelBuffer {
+		t.Errorf("agent a has %d cancellations, expected %d", len(a), cancelBuffer)
+	}
+}
+
+// calcTimeout считает выражение, не давая тесту зависнуть без агента
+func calcTimeout(t *testing.T, e *expression) (float64, error) {
+	t.Helper()
+
+	done := make(chan struct{})
+	var result float64
+	var err error
+	go func() {
+		defer close(done)
+		result, err = e.calc()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("calc of expression %d timed out", e.id)
+	}
+	return result, err
+}
+
+// TestAgentRoundTrip гоняет выражения через настоящего агента по gRPC:
+// результаты и промежуточные значения должны доходить без потери точности
+func TestAgentRoundTrip(t *testing.T) {
+	startAgent(t)
+
+	tests := []struct {
+		expression string
+		expected   float64
+	}{
+		{"1e20+1", 1e20},
+		{"0.0000001*3", 3e-07},
+		{"0.1+0.2-0.3", 5.551115123125783e-17},
+		{"(2^53+1)*2", 18014398509481984},
+		{"1/3*3-1", 0},
+		{"sqrt(2)^2", 2.0000000000000004},
+		{"-1e-300/1e10", -1e-310},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			node, err := ast.Build(tt.expression)
+			if err != nil {
+				t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+			}
+
+			result, err := calcTimeout(t, NewExpression(1, node))
+			if err != nil {
+				t.Fatalf("calc(%s) error: %v", tt.expression, err)
+			}
+			if result != tt.expected {
+				t.Errorf("calc(%s) = %v, expected %v", tt.expression, result, tt.expected)
+			}
+		})
+	}
+}
+
+// TestAgentMatchesEvaluate сверяет распределенное вычисление с локальным calculator.Evaluate
+func TestAgentMatchesEvaluate(t *testing.T) {
+	startAgent(t)
+
+	decimalMode := models.Precision{Mode: models.ModeDecimal, Scale: 10, Rounding: "half_up"}
+	rational := models.Precision{Mode: models.ModeRational}
+	floatMode := models.Precision{Mode: models.ModeFloat}
+
+	tests := []struct {
+		expression string
+		precision  models.Precision
+	}{
+		{"2+2*2", floatMode},
+		{"(1+0.5)^2*2-7//2+7%4", floatMode},
+		{"sin(pi/6)+ln(e^2)-sqrt(2)", floatMode},
+		{"round(2.345, 2)*max(1, -2, 3.5)", floatMode},
+		{"3!^2-2*3!", floatMode},
+		{"!(2>=3)&&1!=2", floatMode},
+		{"1<2?1/(1-1):5", floatMode},
+		{"1>2?1/(1-1):5", floatMode},
+		{"0&&sqrt(-1)", floatMode},
+		{"sqrt(1-2)", floatMode},
+		{"(170+1)!", floatMode},
+		{"(0-8)^(1/3)", floatMode},
+		{"1e300*1e300", floatMode},
+		{"0.1*3-0.3", floatMode},
+		{"1/3+1/6", decimalMode},
+		{"2^0.5+1", decimalMode},
+		{"round(1.005, 2)+sqrt(0.25)", decimalMode},
+		{"1/3+1/6", rational},
+		{"(2/3)^-2 > 2 ? 1/7 : 0", rational},
+		{"sqrt(9/4)-sqrt(2)", rational},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			node, err := ast.Build(tt.expression)
+			if err != nil {
+				t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+			}
+
+			local, localErr := calculator.EvaluateTree(node, calculator.WithPrecision(tt.precision))
+
+			// calc меняет дерево, поэтому локальный вычислитель считает первым
+			e := NewExpression(i+1, node).withPrecision(tt.precision)
+			result, err := calcTimeout(t, e)
+
+			if fmt.Sprint(err) != fmt.Sprint(localErr) {
+				t.Fatalf("calc(%s) error = %v, Evaluate error = %v", tt.expression, err, localErr)
+			}
+			if err == nil && (result != local.Value || e.exact() != local.Exact) {
+				t.Errorf("calc(%s) = %v %q, Evaluate = %v %q", tt.expression, result, e.exact(), local.Value, local.Exact)
+			}
+		})
+	}
+}
+
+// агент получил задачу и отключился: задача уходит следующему агенту, выражение не зависает
+func TestAgentDisconnect(t *testing.T) {
+	resume := pauseFakeAgent()
+	defer resume()
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterOrchestratorServer(srv, NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := pb.NewOrchestratorClient(conn).Calculate(ctx)
+	if err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+
+	node, err := ast.Build("(1+2)*3")
+	if err != nil {
+		t.Fatalf("ast.Build error: %v", err)
+	}
+	e := NewExpression(1, node)
+	done := make(chan struct{})
+	var result float64
+	go func() {
+		defer close(done)
+		result, err = e.calc()
+	}()
+
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	cancel()
+	conn.Close()
+
+	t.Setenv("ORCHESTRATOR_GRPS_URL", lis.Addr().String())
+	go agent.New(config.Config{AgentComputingPower: 2}).Run()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expression hung after the agent disconnected")
+	}
+	if err != nil || result != 9 {
+		t.Errorf("calc = %v, %v; expected 9", result, err)
+	}
+}
+
+// агент получает остаток срока выражения, а не сам срок
+func TestTaskBudget(t *testing.T) {
+	resume := pauseFakeAgent()
+	defer resume()
+
+	lis, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	pb.RegisterOrchestratorServer(srv, NewServer())
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer conn.Close()
+	stream, err := pb.NewOrchestratorClient(conn).Calculate(context.Background())
+	if err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+
+	node, err := ast.Build("(1+2)*3")
+	if err != nil {
+		t.Fatalf("ast.Build error: %v", err)
+	}
+	e := NewExpression(320, node).withDeadline(time.Now().Add(time.Minute))
+	done := make(chan error)
+	go func() {
+		_, err := e.calc()
+		done <- err
+	}()
+
+	req, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if req.BudgetMs <= 0 || req.BudgetMs > time.Minute.Milliseconds() {
+		t.Errorf("budget = %d ms, expected up to a minute", req.BudgetMs)
+	}
+
+	cancelExpression(e.id)
+	select {
+	case err := <-done:
+		if !errors.Is(err, models.ErrCancelled) {
+			t.Errorf("calc = %v; expected %v", err, models.ErrCancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("calc of expression 320 was not cancelled")
+	}
+
+	// агент, которому отдана задача, получает отмену выражения
+	req, err = stream.Recv()
+	if err != nil {
+		t.Fatalf("Recv failed: %v", err)
+	}
+	if !req.Cancel || req.ExpressionId != 320 {
+		t.Errorf("message = %v, expected cancellation of expression 320", req)
+	}
+}
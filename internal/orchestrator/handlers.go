@@ -12,6 +12,7 @@ import (
 	"calculator/internal/database"
 	"calculator/pkg/ast"
 	"calculator/pkg/models"
+	"calculator/pkg/optimizer"
 	"calculator/pkg/pass_system/jwt"
 	"calculator/pkg/pass_system/password"
 )
@@ -163,42 +164,243 @@ func LoginHandler(w http.ResponseWriter, r *http.Request, db *database.DB) {
 }
 
 // Вычисление выражения
+// выражение сохраняется со статусом pending и считается в фоне, клиент сразу получает его id
 func ExpressionHandler(w http.ResponseWriter, r *http.Request, db *database.DB) {
-	var req struct {
-		Expression string `json:"expression"`
+	var req ExpressionReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Expression == "" {
+		errorResponse(w, "no expression provided", http.StatusUnprocessableEntity)
+		return
+	}
+
+	parser, err := req.parser()
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	precision, err := req.precision()
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	timeout, err := req.timeout()
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	priority, err := req.priority()
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tree, err := parser.Parse(req.Expression)
+	if err != nil {
+		parseErrorResponse(w, err, req.Expression)
+		return
+	}
+
+	userId := r.Context().Value(userID).(int)
+	// каноническая запись строится по дереву с именами переменных, оптимизатор его не трогает
+	id, err := db.InsertExpression(r.Context(), userId, req.Expression, ast.Unparse(tree.Symbolic))
+	if err != nil {
+		log.Printf("failed to save expression: %v", err)
+		errorResponse(w, "internal server error", http.StatusInternalServerError)
+		return
 	}
 
+	// срок отсчитывается от приема выражения, а не от начала вычисления
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+
+	root := optimizer.Optimize(tree.Root, policy, precision)
+	state := models.ExpressionState{ID: id, Precision: precision, NoCache: req.NoCache, Deadline: deadline, UserID: userId, Priority: priority}
+	if err := saveState(r.Context(), db, root, state); err != nil {
+		log.Printf("expression %d: %v", id, err)
+	}
+
+	e := NewExpression(id, root).withPrecision(precision).withDeadline(deadline).withOwner(userId, priority).withStore(db)
+	if !req.NoCache {
+		e.withCache(taskCache)
+	}
+	start(db, e)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(RespID{Id: id})
+}
+
+// Проверка выражения без вычисления: возвращает сразу все найденные ошибки
+func ValidateHandler(w http.ResponseWriter, r *http.Request) {
+	var req ExpressionReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		errorResponse(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	// Создаём выражение локально
-	expr := &Expression{
-		exp: req.Expression,
-		id:  0, // можно генерировать при сохранении в БД
+	if req.Expression == "" {
+		errorResponse(w, "no expression provided", http.StatusUnprocessableEntity)
+		return
 	}
 
-	astRoot, err := ast.Build(expr.exp)
+	parser, err := req.parser()
 	if err != nil {
-		db.UpdateExpression(r.Context(), expr.id, err.Error(), 0)
-		errorResponse(w, err.Error(), http.StatusInternalServerError)
+		errorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	calc := NewExpression(astRoot)
-	result, err := calc.calc()
+	diagnostics := parser.Validate(req.Expression)
+	resp := ValidateResp{
+		Valid:  len(diagnostics) == 0,
+		Errors: make([]ParseErrorResp, 0, len(diagnostics)),
+	}
+	for _, pe := range diagnostics {
+		resp.Errors = append(resp.Errors, newParseErrorResp(pe, req.Expression))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Разбор выражения без вычисления: дерево в формате json, dot или sexpr
+// для dot и sexpr число узлов, глубина и обратная польская запись передаются в заголовках X-Ast-*
+func ParseHandler(w http.ResponseWriter, r *http.Request) {
+	var req ParseReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorResponse(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Expression == "" {
+		errorResponse(w, "no expression provided", http.StatusUnprocessableEntity)
+		return
+	}
+
+	format, err := treeFormat(r, req.Format)
 	if err != nil {
-		db.UpdateExpression(r.Context(), expr.id, "zero division error", 0)
 		errorResponse(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Сохраняем результат в БД (если нужно)
-	db.UpdateExpression(r.Context(), expr.id, "done", result)
+	parser, err := req.parser()
+	if err != nil {
+		errorResponse(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	tree, err := parser.Parse(req.Expression)
+	if err != nil {
+		parseErrorResponse(w, err, req.Expression)
+		return
+	}
+
+	resp := ParseResp{
+		Tree:       tree.Root,
+		Normalized: ast.Unparse(tree.Symbolic),
+		LaTeX:      ast.LaTeX(tree.Symbolic),
+		Nodes:      ast.Nodes(tree.Root),
+		Depth:      ast.Depth(tree.Root),
+		RPN:        tree.RPN,
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", treeFormats[format])
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(resp)
+		return
+	}
+
+	body := ast.SExpr(tree.Root) + "\n"
+	if format == "dot" {
+		body = ast.DOT(tree.Root)
+	}
+	w.Header().Set("Content-Type", treeFormats[format])
+	w.Header().Set("X-Ast-Nodes", strconv.Itoa(resp.Nodes))
+	w.Header().Set("X-Ast-Depth", strconv.Itoa(resp.Depth))
+	w.Header().Set("X-Ast-Rpn", strings.Join(resp.RPN, " "))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body))
+}
+
+// Счетчики кэша результатов задач
+func CacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := CacheStatsResp{Enabled: taskCache != nil}
+	if taskCache != nil {
+		resp.Stats = taskCache.Stats()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Отмена выражения: DELETE /api/v1/expressions/{id} или POST /api/v1/expressions/{id}/cancel
+// оставшиеся задачи не считаются, статус становится cancelled; повторная отмена ничего не меняет,
+// а завершенное выражение отменить нельзя
+func CancelHandler(w http.ResponseWriter, r *http.Request, db *database.DB) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/expressions/")
+	if r.Method == http.MethodPost {
+		var ok bool
+		if path, ok = strings.CutSuffix(path, "/cancel"); !ok {
+			errorResponse(w, "not found", http.StatusNotFound)
+			return
+		}
+	}
+	if !checkId(path) {
+		errorResponse(w, "invalid expression id", http.StatusBadRequest)
+		return
+	}
+	id, _ := strconv.Atoi(path)
+	userId := r.Context().Value(userID).(int)
+
+	expr, err := db.SelectExprByID(r.Context(), id, userId)
+	if err != nil {
+		errorResponse(w, "expression does not exist", http.StatusNotFound)
+		return
+	}
+
+	if expr.Status != models.StatusCancelled {
+		ok, err := db.CancelExpression(r.Context(), id, userId)
+		if err != nil {
+			log.Printf("expression %d: %v", id, err)
+			errorResponse(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			errorResponse(w, "expression is already finished", http.StatusConflict)
+			return
+		}
+		cancelExpression(id)
+		log.Printf("expression %d cancelled by user %d", id, userId)
+
+		if expr, err = db.SelectExprByID(r.Context(), id, userId); err != nil {
+			errorResponse(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(expr)
+}
+
+// Очереди планировщика задач: общая глубина и очереди самого пользователя
+func SchedulerStatsHandler(w http.ResponseWriter, r *http.Request) {
+	userId := r.Context().Value(userID).(int)
+
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]float64{"result": result})
+	json.NewEncoder(w).Encode(sched.stats(userId))
 }
 
 // Получение данных по ID или всех выражений
@@ -208,7 +410,7 @@ func GetDataHandler(w http.ResponseWriter, r *http.Request, db *database.DB) {
 		idInt, _ := strconv.Atoi(path)
 		userId := r.Context().Value(userID).(int)
 
-		expr, _, err := db.SelectExprByID(r.Context(), idInt, userId)
+		expr, err := db.SelectExprByID(r.Context(), idInt, userId)
 		if err != nil {
 			errorResponse(w, "expression does not exist", http.StatusNotFound)
 			return
@@ -0,0 +1,293 @@
+package orchestrator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"calculator/pkg/ast"
+	"calculator/pkg/models"
+)
+
+func TestParseErrorResponse(t *testing.T) {
+	expression := "2+*3"
+	_, err := ast.Build(expression)
+	if err == nil {
+		t.Fatalf("ast.Build(%s) expected error", expression)
+	}
+
+	w := httptest.NewRecorder()
+	parseErrorResponse(w, err, expression)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, expected %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	var resp ParseErrorResp
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	expected := ParseErrorResp{
+		Res:      "two operators are next to each other at position 2",
+		Code:     "merged_operators",
+		Position: 2,
+		Length:   1,
+		Token:    "*",
+		Snippet:  "2+*3\n  ^",
+	}
+	if resp != expected {
+		t.Errorf("response = %+v, expected %+v", resp, expected)
+	}
+}
+
+func TestValidateHandler(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+		valid  bool
+		codes  []string
+	}{
+		{`{"expression": "2+2*2"}`, http.StatusOK, true, nil},
+		{`{"expression": "rate*(1+x", "variables": {"rate": 2}}`, http.StatusOK, false, []string{"not_closed_bracket", "unbound_variable"}},
+		{`{"expression": "2+*3 + ()"}`, http.StatusOK, false, []string{"merged_operators", "empty_brackets"}},
+		{`{"expression": "x > 0 ? 1/x : 0", "variables": {"x": 2}}`, http.StatusOK, true, nil},
+		{`{"expression": "1 ? 2 + 3"}`, http.StatusOK, false, []string{"unbalanced_conditional"}},
+		{`{"expression": "if(1, 2) + 1"}`, http.StatusOK, false, []string{"arguments_count"}},
+		{`{"expression": "2(3+4)"}`, http.StatusOK, false, []string{"invalid_expression"}},
+		{`{"expression": "2(3+4)", "syntax": "math"}`, http.StatusOK, true, nil},
+		{`{"expression": "2(3+4)", "syntax": "latex"}`, http.StatusBadRequest, false, nil},
+		{`{"expression": ""}`, http.StatusUnprocessableEntity, false, nil},
+		{`{invalid json}`, http.StatusBadRequest, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/validate", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			ValidateHandler(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, expected %d", w.Code, tt.status)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			var resp ValidateResp
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Valid != tt.valid || len(resp.Errors) != len(tt.codes) {
+				t.Fatalf("response = %+v, expected valid = %v and codes %v", resp, tt.valid, tt.codes)
+			}
+			for i, e := range resp.Errors {
+				if e.Code != tt.codes[i] {
+					t.Errorf("errors[%d].code = %s, expected %s", i, e.Code, tt.codes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExpressionPrecision(t *testing.T) {
+	scale := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		req      ExpressionReq
+		expected models.Precision
+		err      string
+	}{
+		{"default", ExpressionReq{}, models.Precision{Mode: models.ModeFloat}, ""},
+		{"float", ExpressionReq{Precision: "float"}, models.Precision{Mode: models.ModeFloat}, ""},
+		{"decimal defaults", ExpressionReq{Precision: "decimal"}, models.Precision{Mode: models.ModeDecimal, Scale: 20, Rounding: "half_even"}, ""},
+		{"decimal", ExpressionReq{Precision: "decimal", Scale: scale(0), Rounding: "floor"}, models.Precision{Mode: models.ModeDecimal, Scale: 0, Rounding: "floor"}, ""},
+		{"scale without decimal", ExpressionReq{Scale: scale(5)}, models.Precision{}, `scale and rounding require "precision": "decimal"`},
+		{"rounding without decimal", ExpressionReq{Precision: "float", Rounding: "up"}, models.Precision{}, `scale and rounding require "precision": "decimal"`},
+		{"negative scale", ExpressionReq{Precision: "decimal", Scale: scale(-1)}, models.Precision{}, "scale must be between 0 and 1000"},
+		{"huge scale", ExpressionReq{Precision: "decimal", Scale: scale(1001)}, models.Precision{}, "scale must be between 0 and 1000"},
+		{"unknown rounding", ExpressionReq{Precision: "decimal", Rounding: "nearest"}, models.Precision{}, "unknown rounding mode: nearest"},
+		{"unknown precision", ExpressionReq{Precision: "double"}, models.Precision{}, "unknown number mode: double"},
+		{"rational", ExpressionReq{NumberMode: "rational"}, models.Precision{Mode: models.ModeRational}, ""},
+		{"same modes", ExpressionReq{Precision: "decimal", NumberMode: "decimal"}, models.Precision{Mode: models.ModeDecimal, Scale: 20, Rounding: "half_even"}, ""},
+		{"conflicting modes", ExpressionReq{Precision: "decimal", NumberMode: "rational"}, models.Precision{}, "conflicting number modes: precision decimal, number_mode rational"},
+		{"rational with scale", ExpressionReq{NumberMode: "rational", Scale: scale(2)}, models.Precision{}, `scale and rounding require "precision": "decimal"`},
+		{"unknown number mode", ExpressionReq{NumberMode: "complex"}, models.Precision{}, "unknown number mode: complex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.req.precision()
+			errText := ""
+			if err != nil {
+				errText = err.Error()
+			}
+			if got != tt.expected || errText != tt.err {
+				t.Errorf("precision() = %+v, %q; expected %+v, %q", got, errText, tt.expected, tt.err)
+			}
+		})
+	}
+}
+
+func TestExpressionTimeout(t *testing.T) {
+	ms := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		max      time.Duration
+		req      ExpressionReq
+		expected time.Duration
+		err      string
+	}{
+		{"server maximum by default", time.Minute, ExpressionReq{}, time.Minute, ""},
+		{"no limits", 0, ExpressionReq{}, 0, ""},
+		{"own timeout", time.Minute, ExpressionReq{TimeoutMs: ms(500)}, 500 * time.Millisecond, ""},
+		{"own timeout without maximum", 0, ExpressionReq{TimeoutMs: ms(500)}, 500 * time.Millisecond, ""},
+		{"capped by maximum", time.Second, ExpressionReq{TimeoutMs: ms(5000)}, time.Second, ""},
+		{"zero", time.Minute, ExpressionReq{TimeoutMs: ms(0)}, 0, "timeout_ms must be positive, got 0"},
+		{"negative", time.Minute, ExpressionReq{TimeoutMs: ms(-1)}, 0, "timeout_ms must be positive, got -1"},
+		// timeout_ms * time.Millisecond не помещается в time.Duration
+		{"overflow capped by maximum", time.Minute, ExpressionReq{TimeoutMs: ms(math.MaxInt64)}, time.Minute, ""},
+		{"overflow without maximum", 0, ExpressionReq{TimeoutMs: ms(math.MaxInt64)}, 0,
+			fmt.Sprintf("timeout_ms must be at most 9223372036854, got %d", math.MaxInt64)},
+		{"largest without maximum", 0, ExpressionReq{TimeoutMs: ms(9223372036854)}, 9223372036854 * time.Millisecond, ""},
+	}
+
+	defer func(old time.Duration) { maxTimeout = old }(maxTimeout)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			maxTimeout = tt.max
+			got, err := tt.req.timeout()
+			errText := ""
+			if err != nil {
+				errText = err.Error()
+			}
+			if got != tt.expected || errText != tt.err {
+				t.Errorf("timeout() = %v, %q; expected %v, %q", got, errText, tt.expected, tt.err)
+			}
+		})
+	}
+}
+
+func TestExpressionPriority(t *testing.T) {
+	tests := []struct {
+		priority string
+		expected string
+		err      string
+	}{
+		{"", models.PriorityInteractive, ""},
+		{"interactive", models.PriorityInteractive, ""},
+		{"batch", models.PriorityBatch, ""},
+		{"urgent", "", "unknown priority: urgent"},
+	}
+
+	for _, tt := range tests {
+		got, err := ExpressionReq{Priority: tt.priority}.priority()
+		errText := ""
+		if err != nil {
+			errText = err.Error()
+		}
+		if got != tt.expected || errText != tt.err {
+			t.Errorf("priority(%q) = %q, %q; expected %q, %q", tt.priority, got, errText, tt.expected, tt.err)
+		}
+	}
+}
+
+func TestParseHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		accept      string
+		body        string
+		status      int
+		contentType string
+		expected    string // начало тела для dot и sexpr
+	}{
+		{"json by default", "/api/v1/parse", "", `{"expression": "2+3*4"}`, http.StatusOK, "application/json", ""},
+		{"format field", "/api/v1/parse", "", `{"expression": "2+3*4", "format": "sexpr"}`, http.StatusOK, "text/x-sexpr", "(+ 2 (* 3 4))\n"},
+		{"format parameter", "/api/v1/parse?format=dot", "", `{"expression": "2+3*4"}`, http.StatusOK, "text/vnd.graphviz", "digraph ast {"},
+		{"accept header", "/api/v1/parse", "text/vnd.graphviz;q=0.9, */*", `{"expression": "2+3*4"}`, http.StatusOK, "text/vnd.graphviz", "digraph ast {"},
+		{"accept text", "/api/v1/parse", "text/plain", `{"expression": "2x+1", "syntax": "math", "variables": {"x": 3}}`, http.StatusOK, "text/x-sexpr", "(+ (* 2 3) 1)\n"},
+		{"field over header", "/api/v1/parse", "text/vnd.graphviz", `{"expression": "2+3*4", "format": "json"}`, http.StatusOK, "application/json", ""},
+		{"unknown format", "/api/v1/parse?format=png", "", `{"expression": "2+3*4"}`, http.StatusBadRequest, "", ""},
+		{"parse error", "/api/v1/parse", "", `{"expression": "2+*3"}`, http.StatusUnprocessableEntity, "", ""},
+		{"empty expression", "/api/v1/parse", "", `{"expression": ""}`, http.StatusUnprocessableEntity, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			ParseHandler(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, expected %d: %s", w.Code, tt.status, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %s, expected %s", got, tt.contentType)
+			}
+
+			if tt.contentType != "application/json" {
+				if !strings.HasPrefix(w.Body.String(), tt.expected) {
+					t.Errorf("body = %q, expected to start with %q", w.Body, tt.expected)
+				}
+				if w.Header().Get("X-Ast-Nodes") == "" || w.Header().Get("X-Ast-Rpn") == "" {
+					t.Errorf("headers = %v, expected X-Ast-Nodes and X-Ast-Rpn", w.Header())
+				}
+				return
+			}
+
+			var resp ParseResp
+			if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if resp.Tree == nil || resp.Tree.Value != "+" || resp.Nodes != 5 || resp.Depth != 3 ||
+				strings.Join(resp.RPN, " ") != "2 3 4 * +" {
+				t.Errorf("response = %+v, expected tree of 2+3*4 with 5 nodes, depth 3 and RPN 2 3 4 * +", resp)
+			}
+			if resp.Normalized != "2 + 3 * 4" || resp.LaTeX != `2 + 3 \cdot 4` {
+				t.Errorf("normalized = %q, latex = %q; expected 2 + 3 * 4 and 2 + 3 \\cdot 4", resp.Normalized, resp.LaTeX)
+			}
+		})
+	}
+}
+
+// без базы проверяются только адрес и id: выражений в ней нет
+func TestCancelHandler(t *testing.T) {
+	tests := []struct {
+		method string
+		target string
+		status int
+	}{
+		{http.MethodDelete, "/api/v1/expressions/abc", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/expressions/abc/cancel", http.StatusBadRequest},
+		{http.MethodPost, "/api/v1/expressions/5", http.StatusNotFound},
+		{http.MethodDelete, "/api/v1/expressions/5/cancel", http.StatusBadRequest},
+		{http.MethodDelete, "/api/v1/expressions/5", http.StatusNotFound},
+		{http.MethodPost, "/api/v1/expressions/5/cancel", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		r = r.WithContext(context.WithValue(r.Context(), userID, 1))
+		w := httptest.NewRecorder()
+		CancelHandler(w, r, nil)
+
+		if w.Code != tt.status {
+			t.Errorf("%s %s: status = %d, expected %d: %s", tt.method, tt.target, w.Code, tt.status, w.Body)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package orchestrator
+
+// аренда задач: задача, отданная агенту, числится за ним до результата или до конца срока
+// если агент отключился или не уложился в срок, задача отправляется снова, возможно другому агенту;
+// после maxAttempts неудачных отправок выражение получает ошибку вместо результата
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "calculator/api/gen/go/v2"
+	"calculator/pkg/models"
+)
+
+const (
+	defaultLeaseTimeout = 30 * time.Second
+	defaultMaxAttempts  = 3
+)
+
+var leases = newLeaseTable(defaultLeaseTimeout, defaultMaxAttempts, tasksCh, resultsCh, exprs.active)
+
+type leaseKey struct {
+	exprID, nodeID int
+}
+
+type lease struct {
+	task     task
+	req      *pb.TaskRequest // задача в том виде, в котором ее получил агент
+	agent    string          // пустой - задача ждет повторной отправки
+	deadline time.Time
+	attempts int
+}
+
+type leaseTable struct {
+	mu          sync.Mutex
+	leases      map[leaseKey]*lease
+	timeout     time.Duration
+	maxAttempts int
+
+	tasks   chan<- task          // куда возвращаются задачи для повторной отправки, минуя очередь планировщика
+	results chan<- models.Result // куда уходит ошибка задачи, исчерпавшей попытки
+	active  func(exprID int) bool
+}
+
+func newLeaseTable(timeout time.Duration, attempts int, tasks chan<- task, results chan<- models.Result, active func(int) bool) *leaseTable {
+	return &leaseTable{
+		leases:      make(map[leaseKey]*lease),
+		timeout:     timeout,
+		maxAttempts: attempts,
+		tasks:       tasks,
+		results:     results,
+		active:      active,
+	}
+}
+
+// configure задает срок аренды и число попыток, нулевые значения оставляют прежние
+func (l *leaseTable) configure(timeout time.Duration, attempts int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if timeout > 0 {
+		l.timeout = timeout
+	}
+	if attempts > 0 {
+		l.maxAttempts = attempts
+	}
+}
+
+// grant отдает задачу агенту, вызывается до отправки, чтобы задача не потерялась при ошибке отправки
+func (l *leaseTable) grant(t task, req *pb.TaskRequest, agent string) {
+	l.mu.Lock()
+	key := leaseKey{t.exprID, int(req.Id)}
+	ls, ok := l.leases[key]
+	if !ok {
+		ls = &lease{task: t, req: req}
+		l.leases[key] = ls
+	}
+	ls.agent = agent
+	ls.deadline = time.Now().Add(l.timeout)
+	ls.attempts++
+	l.mu.Unlock()
+
+	if t.db != nil {
+		if err := t.db.StartTask(context.Background(), t.exprID, int(req.Id), agent); err != nil {
+			log.Printf("expression %d: %v", t.exprID, err)
+		}
+	}
+}
+
+// release снимает аренду, когда пришел результат
+// результат принимается от любого агента: опоздавший ответ первого агента так же верен, как ответ второго
+func (l *leaseTable) release(exprID, nodeID int) {
+	l.mu.Lock()
+	delete(l.leases, leaseKey{exprID, nodeID})
+	l.mu.Unlock()
+}
+
+// cancel снимает аренды задач отмененного выражения и возвращает агентов, которые их держали
+func (l *leaseTable) cancel(exprID int) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var holders []string
+	for key, ls := range l.leases {
+		if key.exprID != exprID {
+			continue
+		}
+		delete(l.leases, key)
+		if ls.agent != "" && !seen[ls.agent] {
+			seen[ls.agent] = true
+			holders = append(holders, ls.agent)
+		}
+	}
+	return holders
+}
+
+// redelivery - что сделать с задачей, которую сняли с агента: отправить снова или завершить ошибкой
+type redelivery struct {
+	task   task
+	result *models.Result // не nil - попытки исчерпаны
+}
+
+// revoke возвращает в очередь все задачи отключившегося агента
+func (l *leaseTable) revoke(agent string) {
+	l.mu.Lock()
+	var pending []redelivery
+	for key, ls := range l.leases {
+		if ls.agent == agent {
+			pending = l.redeliver(pending, key, ls, "agent disconnected")
+		}
+	}
+	l.mu.Unlock()
+
+	l.deliver(pending)
+}
+
+// expire возвращает в очередь задачи с истекшим сроком аренды
+func (l *leaseTable) expire(now time.Time) {
+	l.mu.Lock()
+	var pending []redelivery
+	for key, ls := range l.leases {
+		if ls.agent != "" && now.After(ls.deadline) {
+			log.Printf("lease of task %d of expression %d held by %s expired", key.nodeID, key.exprID, ls.agent)
+			pending = l.redeliver(pending, key, ls, fmt.Sprintf("lease of %v expired", l.timeout))
+		}
+	}
+	l.mu.Unlock()
+
+	l.deliver(pending)
+}
+
+// watch проверяет сроки аренды, пока работает оркестратор
+func (l *leaseTable) watch() {
+	l.mu.Lock()
+	interval := min(max(l.timeout/4, 10*time.Millisecond), time.Second)
+	l.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		l.expire(now)
+	}
+}
+
+// redeliver вызывается под l.mu: он только меняет таблицу и добавляет задачу в pending,
+// запись в базу и отправка идут в deliver уже без блокировки, чтобы не задерживать grant и release
+func (l *leaseTable) redeliver(pending []redelivery, key leaseKey, ls *lease, reason string) []redelivery {
+	if !l.active(key.exprID) {
+		delete(l.leases, key)
+		return pending
+	}
+
+	if ls.attempts >= l.maxAttempts {
+		delete(l.leases, key)
+		res := &models.Result{
+			ID:           key.nodeID,
+			ExpressionID: key.exprID,
+			Error:        fmt.Sprintf("task %d failed after %d attempts: %s", key.nodeID, ls.attempts, reason),
+		}
+		return append(pending, redelivery{task: ls.task, result: res})
+	}
+
+	log.Printf("redelivering task %d of expression %d: %s", key.nodeID, key.exprID, reason)
+	ls.agent = ""
+	t := ls.task
+	t.req = ls.req
+	return append(pending, redelivery{task: t})
+}
+
+// deliver отправляет снятые с агентов задачи снова или их ошибки
+// каналы без буфера, поэтому отправка идет из отдельной горутины
+func (l *leaseTable) deliver(pending []redelivery) {
+	for _, r := range pending {
+		if r.result != nil {
+			res := *r.result
+			go func() { l.results <- res }()
+			continue
+		}
+
+		t := r.task
+		if t.db != nil {
+			if err := t.db.QueueTask(context.Background(), t.exprID, int(t.req.Id), t.req.Operator, requestArgs(t.req)); err != nil {
+				log.Printf("expression %d: %v", t.exprID, err)
+			}
+		}
+		go func() { l.tasks <- t }()
+	}
+}
+
+// requestArgs - аргументы задачи в том же порядке, что и operands
+func requestArgs(req *pb.TaskRequest) []string {
+	if req.Args != nil {
+		return req.Args
+	}
+	if req.Arg2 == "" {
+		return []string{req.Arg1}
+	}
+	return []string{req.Arg1, req.Arg2}
+}
@@ -0,0 +1,139 @@
+package orchestrator
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	pb "calculator/api/gen/go/v2"
+	"calculator/pkg/models"
+)
+
+// newTestLeases - таблица аренды со своими каналами вместо общих tasksCh и resultsCh
+func newTestLeases(attempts int, active func(int) bool) (*leaseTable, chan task, chan models.Result) {
+	tasks := make(chan task, 10)
+	results := make(chan models.Result, 10)
+	return newLeaseTable(time.Second, attempts, tasks, results, active), tasks, results
+}
+
+func always(int) bool { return true }
+
+func TestLeaseRevoke(t *testing.T) {
+	l, tasks, _ := newTestLeases(3, always)
+
+	l.grant(task{exprID: 1}, &pb.TaskRequest{Id: 5, Operator: "+", Arg1: "1", Arg2: "2"}, "a")
+	l.grant(task{exprID: 1}, &pb.TaskRequest{Id: 6, Operator: "sqrt", Args: []string{"4"}}, "b")
+	l.grant(task{exprID: 2}, &pb.TaskRequest{Id: 5, Operator: "-", Arg1: "3"}, "a")
+	l.release(2, 5)
+
+	l.revoke("a")
+
+	select {
+	case got := <-tasks:
+		if got.exprID != 1 || got.req == nil || got.req.Id != 5 {
+			t.Errorf("redelivered task = %+v, expected task 5 of expression 1", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task of the disconnected agent was not redelivered")
+	}
+
+	// задачи другого агента и задачи с результатом остаются на месте
+	select {
+	case got := <-tasks:
+		t.Errorf("unexpected redelivery of %+v", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLeaseAttempts(t *testing.T) {
+	l, tasks, results := newTestLeases(2, always)
+	req := &pb.TaskRequest{Id: 7, Operator: "*", Arg1: "2", Arg2: "3"}
+
+	l.grant(task{exprID: 3}, req, "a")
+	l.expire(time.Now().Add(2 * time.Second))
+
+	var again task
+	select {
+	case again = <-tasks:
+	case <-time.After(time.Second):
+		t.Fatal("expired task was not redelivered")
+	}
+
+	// вторая попытка последняя: после нее выражение получает ошибку
+	l.grant(again, again.req, "b")
+	l.expire(time.Now().Add(2 * time.Second))
+
+	select {
+	case res := <-results:
+		expected := "task 7 failed after 2 attempts: lease of 1s expired"
+		if res.ID != 7 || res.ExpressionID != 3 || res.Error != expected {
+			t.Errorf("result = %+v, expected error %q", res, expected)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error after the last attempt")
+	}
+
+	// у живой аренды срок не истек
+	l.grant(task{exprID: 4}, &pb.TaskRequest{Id: 1, Operator: "+", Arg1: "1", Arg2: "1"}, "c")
+	l.expire(time.Now())
+	if len(tasks) != 0 || len(results) != 0 {
+		t.Error("lease within its deadline should not be redelivered")
+	}
+}
+
+// задачи завершенного выражения не отправляются снова
+func TestLeaseInactive(t *testing.T) {
+	l, tasks, results := newTestLeases(3, func(int) bool { return false })
+
+	l.grant(task{exprID: 1}, &pb.TaskRequest{Id: 1, Operator: "+", Arg1: "1", Arg2: "1"}, "a")
+	l.revoke("a")
+
+	time.Sleep(20 * time.Millisecond)
+	if len(tasks) != 0 || len(results) != 0 || len(l.leases) != 0 {
+		t.Error("lease of a finished expression should be dropped")
+	}
+}
+
+func TestRequestArgs(t *testing.T) {
+	tests := []struct {
+		req      *pb.TaskRequest
+		expected string
+	}{
+		{&pb.TaskRequest{Arg1: "1", Arg2: "2"}, "1 2"},
+		{&pb.TaskRequest{Arg1: "3"}, "3"},
+		{&pb.TaskRequest{Args: []string{"1", "2", "3"}}, "1 2 3"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(requestArgs(tt.req), " "); got != tt.expected {
+			t.Errorf("requestArgs(%v) = %s, expected %s", tt.req, got, tt.expected)
+		}
+	}
+}
+
+func TestLeaseCancel(t *testing.T) {
+	l, tasks, _ := newTestLeases(3, always)
+
+	l.grant(task{exprID: 1}, &pb.TaskRequest{Id: 5, Operator: "+", Arg1: "1", Arg2: "2"}, "a")
+	l.grant(task{exprID: 1}, &pb.TaskRequest{Id: 6, Operator: "-", Arg1: "3"}, "a")
+	l.grant(task{exprID: 1}, &pb.TaskRequest{Id: 7, Operator: "*", Arg1: "2", Arg2: "3"}, "b")
+	l.grant(task{exprID: 2}, &pb.TaskRequest{Id: 5, Operator: "-", Arg1: "3"}, "c")
+
+	holders := l.cancel(1)
+	slices.Sort(holders)
+	if !slices.Equal(holders, []string{"a", "b"}) {
+		t.Errorf("cancel(1) = %v, expected [a b]", holders)
+	}
+
+	// задачи отмененного выражения не возвращаются в очередь, задачи другого выражения остаются за агентом
+	l.revoke("a")
+	l.revoke("c")
+	select {
+	case got := <-tasks:
+		if got.exprID != 2 {
+			t.Errorf("redelivered task of cancelled expression: %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("task of expression 2 was not redelivered")
+	}
+}
@@ -1,14 +1,24 @@
 package orchestrator
 
 import (
+	"calculator/internal/cache"
 	"calculator/internal/database"
+	"calculator/pkg/ast"
+	"calculator/pkg/config"
+	"calculator/pkg/decimal"
+	"calculator/pkg/models"
+	"calculator/pkg/optimizer"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"regexp"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v4" // Обратите внимание на использование pgx/v4
@@ -20,7 +30,16 @@ type (
 	}
 
 	ExpressionReq struct {
-		Expression string `json:"expression"`
+		Expression string             `json:"expression"`
+		Variables  map[string]float64 `json:"variables"`
+		Syntax     string             `json:"syntax"`      // "math" разрешает пропускать знак умножения
+		Precision  string             `json:"precision"`   // "decimal" - точная десятичная арифметика
+		Scale      *int               `json:"scale"`       // знаков после запятой в режиме decimal
+		Rounding   string             `json:"rounding"`    // способ округления в режиме decimal
+		NumberMode string             `json:"number_mode"` // "rational" - точные дроби
+		NoCache    bool               `json:"no_cache"`    // считать все задачи заново, не заглядывая в кэш
+		TimeoutMs  *int               `json:"timeout_ms"`  // срок вычисления, не больше MAX_TIMEOUT_MS
+		Priority   string             `json:"priority"`    // "interactive" (по умолчанию) или "batch"
 	}
 
 	RespID struct {
@@ -31,6 +50,42 @@ type (
 		Res string `json:"error"`
 	}
 
+	// ответ на проверку выражения без вычисления
+	ValidateResp struct {
+		Valid  bool             `json:"valid"`
+		Errors []ParseErrorResp `json:"errors"`
+	}
+
+	// запрос на разбор: поля выражения и формат ответа
+	ParseReq struct {
+		ExpressionReq
+		Format string `json:"format"` // json, dot или sexpr; пустой - по заголовку Accept
+	}
+
+	ParseResp struct {
+		Tree       *models.AstNode `json:"tree"`
+		Normalized string          `json:"normalized"` // каноническая запись с наименьшим числом скобок
+		LaTeX      string          `json:"latex"`
+		Nodes      int             `json:"nodes"`
+		Depth      int             `json:"depth"`
+		RPN        []string        `json:"rpn"` // обратная польская запись, из которой построено дерево
+	}
+
+	CacheStatsResp struct {
+		Enabled bool `json:"enabled"`
+		cache.Stats
+	}
+
+	// ответ на ошибку разбора выражения
+	ParseErrorResp struct {
+		Res      string `json:"error"`
+		Code     string `json:"code"`
+		Position int    `json:"position"`
+		Length   int    `json:"length"`
+		Token    string `json:"token"`
+		Snippet  string `json:"snippet"`
+	}
+
 	Expression struct {
 		exp string
 		id  int
@@ -40,12 +95,34 @@ type (
 	userid     string
 )
 
+var (
+	// политика оптимизатора, задается переменными окружения OPTIMIZE_* при запуске
+	policy = optimizer.DefaultPolicy
+	// кэш результатов задач, nil - кэш выключен (CACHE_SIZE=0 без CACHE_POSTGRES)
+	taskCache *cache.Cache
+	// наибольший срок вычисления выражения, 0 - без ограничения
+	maxTimeout time.Duration
+)
+
+// cacheTier - постоянный уровень кэша в таблице result_cache
+type cacheTier struct {
+	db *database.DB
+}
+
+func (t cacheTier) Get(ctx context.Context, key string) (cache.Entry, bool, error) {
+	result, value, ok, err := t.db.SelectCachedResult(ctx, key)
+	return cache.Entry{Result: result, Value: value}, ok, err
+}
+
+func (t cacheTier) Put(ctx context.Context, key string, entry cache.Entry) error {
+	return t.db.InsertCachedResult(ctx, key, entry.Result, entry.Value)
+}
+
 func New() *Orchestrator {
 	return &Orchestrator{}
 }
 
 var (
-	mu     sync.Mutex // Мьютекс для синхронизации доступа к результатам
 	ctxKey contextKey = "expression id"
 	userID userid     = "user id"
 )
@@ -66,6 +143,150 @@ func errorResponse(w http.ResponseWriter, err string, statusCode int) {
 	json.NewEncoder(w).Encode(e)
 }
 
+// parseErrorResponse отдает ошибку разбора вместе с местом ошибки в выражении
+func parseErrorResponse(w http.ResponseWriter, err error, expression string) {
+	var pe *models.ParseError
+	if !errors.As(err, &pe) {
+		errorResponse(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(newParseErrorResp(pe, expression))
+}
+
+// parser собирает парсер под параметры запроса
+func (req ExpressionReq) parser() (*ast.Parser, error) {
+	syntax, err := ast.ParseSyntax(req.Syntax)
+	if err != nil {
+		return nil, err
+	}
+	// в точных режимах литералы вроде 1e400 допустимы, хотя во float64 не помещаются
+	mode := req.Precision
+	if mode == "" {
+		mode = req.NumberMode
+	}
+	exact := mode == models.ModeDecimal || mode == models.ModeRational
+	return &ast.Parser{Variables: req.Variables, Syntax: syntax, Exact: exact}, nil
+}
+
+// precision проверяет режим чисел запроса
+// режим задается полем precision или number_mode, если указаны оба, они должны совпадать
+func (req ExpressionReq) precision() (models.Precision, error) {
+	mode := req.Precision
+	if req.NumberMode != "" {
+		if mode != "" && mode != req.NumberMode {
+			return models.Precision{}, fmt.Errorf("conflicting number modes: precision %s, number_mode %s", req.Precision, req.NumberMode)
+		}
+		mode = req.NumberMode
+	}
+
+	switch mode {
+	case "", models.ModeFloat:
+		if req.Scale != nil || req.Rounding != "" {
+			return models.Precision{}, errors.New("scale and rounding require \"precision\": \"decimal\"")
+		}
+		return models.Precision{Mode: models.ModeFloat}, nil
+	case models.ModeDecimal:
+		scale := decimal.DefaultScale
+		if req.Scale != nil {
+			scale = *req.Scale
+		}
+		ctx, err := decimal.NewContext(scale, req.Rounding)
+		if err != nil {
+			return models.Precision{}, err
+		}
+		return models.Precision{Mode: models.ModeDecimal, Scale: ctx.Scale, Rounding: string(ctx.Rounding)}, nil
+	case models.ModeRational:
+		if req.Scale != nil || req.Rounding != "" {
+			return models.Precision{}, errors.New("scale and rounding require \"precision\": \"decimal\"")
+		}
+		return models.Precision{Mode: models.ModeRational}, nil
+	default:
+		return models.Precision{}, fmt.Errorf("unknown number mode: %s", mode)
+	}
+}
+
+// timeout - срок вычисления выражения: timeout_ms запроса, но не больше maxTimeout
+// без timeout_ms срок равен maxTimeout, 0 - срока нет
+func (req ExpressionReq) timeout() (time.Duration, error) {
+	if req.TimeoutMs == nil {
+		return maxTimeout, nil
+	}
+	if *req.TimeoutMs <= 0 {
+		return 0, fmt.Errorf("timeout_ms must be positive, got %d", *req.TimeoutMs)
+	}
+
+	// срок сравнивается в миллисекундах: умножение большого timeout_ms на time.Millisecond переполняется
+	ms := int64(*req.TimeoutMs)
+	if maxTimeout > 0 && ms >= maxTimeout.Milliseconds() {
+		return maxTimeout, nil
+	}
+	if ms > math.MaxInt64/int64(time.Millisecond) {
+		return 0, fmt.Errorf("timeout_ms must be at most %d, got %d", math.MaxInt64/int64(time.Millisecond), ms)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// priority проверяет класс приоритета запроса
+func (req ExpressionReq) priority() (string, error) {
+	switch req.Priority {
+	case "", models.PriorityInteractive:
+		return models.PriorityInteractive, nil
+	case models.PriorityBatch:
+		return models.PriorityBatch, nil
+	default:
+		return "", fmt.Errorf("unknown priority: %s", req.Priority)
+	}
+}
+
+// форматы дерева для /api/v1/parse и их типы содержимого
+var treeFormats = map[string]string{
+	"json":  "application/json",
+	"dot":   "text/vnd.graphviz",
+	"sexpr": "text/x-sexpr",
+}
+
+// treeFormat выбирает формат дерева: поле format, параметр ?format=, затем заголовок Accept
+// Accept без известного типа (например, */*) дает json
+func treeFormat(r *http.Request, format string) (string, error) {
+	if format == "" {
+		format = r.URL.Query().Get("format")
+	}
+	if format != "" {
+		if _, ok := treeFormats[format]; !ok {
+			return "", fmt.Errorf("unknown format: %s", format)
+		}
+		return format, nil
+	}
+
+	for _, media := range strings.Split(r.Header.Get("Accept"), ",") {
+		media, _, _ = strings.Cut(media, ";")
+		media = strings.TrimSpace(media)
+		if media == "text/plain" {
+			return "sexpr", nil
+		}
+		for format, contentType := range treeFormats {
+			if media == contentType {
+				return format, nil
+			}
+		}
+	}
+	return "json", nil
+}
+
+func newParseErrorResp(pe *models.ParseError, expression string) ParseErrorResp {
+	return ParseErrorResp{
+		Res:      pe.Error(),
+		Code:     pe.Code(),
+		Position: pe.Position,
+		Length:   pe.Length,
+		Token:    pe.Token,
+		Snippet:  pe.Snippet(expression),
+	}
+}
+
 func checkId(id string) bool {
 	pattern := "^[0-9]+$"
 	r := regexp.MustCompile(pattern)
@@ -90,6 +311,20 @@ func (o *Orchestrator) Run() {
 		log.Fatalf("Migrations failed: %v", err)
 	}
 
+	cfg := config.Load()
+	fold, err := optimizer.ParseFold(cfg.OptimizeFold)
+	if err != nil {
+		log.Fatalf("Invalid OPTIMIZE_FOLD: %v", err)
+	}
+	policy = optimizer.Policy{Fold: fold, Identities: cfg.OptimizeIdentities, Dedupe: cfg.OptimizeDedupe}
+	leases.configure(time.Duration(cfg.LeaseTimeoutMs)*time.Millisecond, cfg.TaskMaxAttempts)
+	maxTimeout = time.Duration(max(cfg.MaxTimeoutMs, 0)) * time.Millisecond
+	weights, err := parseWeights(cfg.UserWeights)
+	if err != nil {
+		log.Fatalf("Invalid USER_WEIGHTS: %v", err)
+	}
+	sched.configure(weights)
+
 	// запуск менеджера каналов выражений
 	StartManager()
 	// запуск сервера для общения с агентом
@@ -100,6 +335,17 @@ func (o *Orchestrator) Run() {
 		log.Fatalf("Failed to connect to DB: %v", err)
 	}
 
+	var tier cache.Tier
+	if cfg.CachePostgres {
+		tier = cacheTier{db: db}
+	}
+	if cfg.CacheSize > 0 || tier != nil {
+		taskCache = cache.New(cfg.CacheSize, tier)
+	}
+
+	// досчитываем выражения, прерванные перезапуском
+	resume(db)
+
 	r := chi.NewRouter()
 	r.Use(logsMiddleware)
 
@@ -115,19 +361,31 @@ func (o *Orchestrator) Run() {
 	calculateRouter.Use(authMiddleware)
 	calculateRouter.Use(databaseMiddleware(db)) // передаём db в middleware
 	calculateRouter.Post("/", func(w http.ResponseWriter, r *http.Request) {
-		expr := &Expression{
-			exp: "2+2",
-			id:  123,
-		}
-		ctx := context.WithValue(r.Context(), ctxKey, expr)
-		ExpressionHandler(w, r.WithContext(ctx), db)
+		ExpressionHandler(w, r, db)
 	})
 
 	r.Mount("/api/v1/calculate", calculateRouter)
 
-	r.With(authMiddleware).Get("/api/v1/expressions/", func(w http.ResponseWriter, r *http.Request) {
+	r.With(authMiddleware).Post("/api/v1/validate", ValidateHandler)
+
+	r.With(authMiddleware).Post("/api/v1/parse", ParseHandler)
+
+	r.With(authMiddleware).Get("/api/v1/cache", CacheStatsHandler)
+
+	r.With(authMiddleware).Get("/api/v1/scheduler", SchedulerStatsHandler)
+
+	r.With(authMiddleware).Get("/api/v1/expressions", func(w http.ResponseWriter, r *http.Request) {
+		GetDataHandler(w, r, db)
+	})
+	r.With(authMiddleware).Get("/api/v1/expressions/*", func(w http.ResponseWriter, r *http.Request) {
 		GetDataHandler(w, r, db)
 	})
+	r.With(authMiddleware).Delete("/api/v1/expressions/*", func(w http.ResponseWriter, r *http.Request) {
+		CancelHandler(w, r, db)
+	})
+	r.With(authMiddleware).Post("/api/v1/expressions/*", func(w http.ResponseWriter, r *http.Request) {
+		CancelHandler(w, r, db)
+	})
 
 	log.Printf("Starting server on port '%s'", orchURL)
 	log.Fatal(http.ListenAndServe(orchURL, r))
@@ -0,0 +1,258 @@
+package orchestrator
+
+// планировщик задач: готовые узлы всех выражений ждут агентов здесь, а не на tasksCh
+// задачи interactive уходят раньше задач batch, но batch получает не меньше одной задачи из batchEvery,
+// чтобы постоянный поток interactive не задерживал фоновые расчеты навсегда; внутри класса пользователи делят агентов
+// по весам (взвешенная справедливая очередь): большое выражение одного пользователя не задерживает остальных
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"calculator/pkg/models"
+)
+
+var sched = newScheduler(tasksCh, exprs.active)
+
+// классы в порядке отправки
+var priorities = []string{models.PriorityInteractive, models.PriorityBatch}
+
+// минимальная доля batch: после batchEvery-1 задач interactive подряд, пока batch ждет, уходит задача batch
+const batchEvery = 10
+
+type queued struct {
+	task   task
+	finish float64 // виртуальное время, к которому задача была бы отправлена при идеальном разделении
+}
+
+// userQueue - задачи одного пользователя в одном классе
+type userQueue struct {
+	tasks  []queued
+	finish float64 // виртуальное время последней задачи в очереди
+}
+
+// class - взвешенная справедливая очередь одного класса приоритета
+type class struct {
+	users map[int]*userQueue
+	vtime float64 // виртуальное время последней отправленной задачи
+}
+
+type scheduler struct {
+	mu         sync.Mutex
+	classes    map[string]*class
+	weights    map[int]float64 // веса пользователей, по умолчанию 1
+	dispatched map[int]int64   // отправлено задач по пользователям с запуска
+	skipped    int             // задач interactive отправлено подряд, пока ждали задачи batch
+
+	ready  chan struct{} // в очереди появилась задача
+	out    chan<- task
+	active func(exprID int) bool
+}
+
+func newScheduler(out chan<- task, active func(int) bool) *scheduler {
+	classes := make(map[string]*class, len(priorities))
+	for _, p := range priorities {
+		classes[p] = &class{users: make(map[int]*userQueue)}
+	}
+	return &scheduler{
+		classes:    classes,
+		weights:    make(map[int]float64),
+		dispatched: make(map[int]int64),
+		ready:      make(chan struct{}, 1),
+		out:        out,
+		active:     active,
+	}
+}
+
+// configure задает веса пользователей
+func (s *scheduler) configure(weights map[int]float64) {
+	s.mu.Lock()
+	s.weights = weights
+	s.mu.Unlock()
+}
+
+// parseWeights читает веса пользователей в виде "1=4,7=2.5"
+func parseWeights(s string) (map[int]float64, error) {
+	weights := make(map[int]float64)
+	if strings.TrimSpace(s) == "" {
+		return weights, nil
+	}
+
+	for _, pair := range strings.Split(s, ",") {
+		user, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid user weight %q, expected user=weight", pair)
+		}
+		id, err := strconv.Atoi(user)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id %q", user)
+		}
+		w, err := strconv.ParseFloat(weight, 64)
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("weight of user %d must be a positive number, got %q", id, weight)
+		}
+		weights[id] = w
+	}
+	return weights, nil
+}
+
+func (s *scheduler) weight(user int) float64 {
+	if w, ok := s.weights[user]; ok {
+		return w
+	}
+	return 1
+}
+
+// push ставит задачу в очередь ее пользователя и не блокируется
+func (s *scheduler) push(t task) {
+	s.mu.Lock()
+	c, ok := s.classes[t.priority]
+	if !ok {
+		c = s.classes[models.PriorityInteractive]
+	}
+	q, ok := c.users[t.user]
+	if !ok {
+		q = &userQueue{}
+		c.users[t.user] = q
+	}
+
+	// пользователь, который долго не присылал задач, не копит право на внеочередную отправку
+	q.finish = max(q.finish, c.vtime) + 1/s.weight(t.user)
+	q.tasks = append(q.tasks, queued{task: t, finish: q.finish})
+	s.mu.Unlock()
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// pop достает задачу с наименьшим виртуальным временем из старшего непустого класса,
+// если batch не пропускал свою очередь слишком долго; задачи выражений, которые уже не считаются, выбрасываются
+func (s *scheduler) pop() (task, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order := priorities
+	if s.skipped >= batchEvery-1 {
+		order = []string{models.PriorityBatch, models.PriorityInteractive}
+	}
+	for _, p := range order {
+		if t, ok := s.popClass(s.classes[p]); ok {
+			if p == models.PriorityInteractive && len(s.classes[models.PriorityBatch].users) > 0 {
+				s.skipped++
+			} else {
+				s.skipped = 0
+			}
+			return t, true
+		}
+	}
+	return task{}, false
+}
+
+// popClass достает задачу пользователя с наименьшим виртуальным временем в классе
+func (s *scheduler) popClass(c *class) (task, bool) {
+	for len(c.users) > 0 {
+		user, q := -1, (*userQueue)(nil)
+		for id, uq := range c.users {
+			if q == nil || uq.tasks[0].finish < q.tasks[0].finish ||
+				(uq.tasks[0].finish == q.tasks[0].finish && id < user) {
+				user, q = id, uq
+			}
+		}
+
+		next := q.tasks[0]
+		q.tasks = q.tasks[1:]
+		if len(q.tasks) == 0 {
+			delete(c.users, user)
+		}
+		c.vtime = next.finish
+
+		if !s.active(next.task.exprID) {
+			continue
+		}
+		s.dispatched[user]++
+		return next.task, true
+	}
+	return task{}, false
+}
+
+// remove выбрасывает из очередей задачи завершившегося выражения
+func (s *scheduler) remove(exprID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.classes {
+		for user, q := range c.users {
+			q.tasks = slices.DeleteFunc(q.tasks, func(qt queued) bool { return qt.task.exprID == exprID })
+			if len(q.tasks) == 0 {
+				delete(c.users, user)
+			}
+		}
+	}
+}
+
+// run отдает задачи агентам по одной: следующая выбирается, только когда агент забрал предыдущую
+func (s *scheduler) run() {
+	log.Println("Task scheduler started")
+	for {
+		t, ok := s.pop()
+		if !ok {
+			<-s.ready
+			continue
+		}
+		s.out <- t
+	}
+}
+
+type (
+	// UserQueueStats - очередь одного пользователя
+	UserQueueStats struct {
+		UserID      int     `json:"user_id"`
+		Weight      float64 `json:"weight"`
+		Interactive int     `json:"interactive"` // задач в очереди
+		Batch       int     `json:"batch"`
+		Dispatched  int64   `json:"dispatched"` // отправлено агентам с запуска
+	}
+
+	SchedulerStats struct {
+		Interactive int              `json:"interactive"`
+		Batch       int              `json:"batch"`
+		Users       []UserQueueStats `json:"users"`
+	}
+)
+
+// stats - общая глубина очередей и очереди пользователя userID; очереди других пользователей не показываются
+// пользователь без задач в очередях показывается, если ему уже отправлялись задачи
+func (s *scheduler) stats(userID int) SchedulerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var stats SchedulerStats
+	dispatched, known := s.dispatched[userID]
+	u := UserQueueStats{UserID: userID, Weight: s.weight(userID), Dispatched: dispatched}
+	for id, q := range s.classes[models.PriorityInteractive].users {
+		if id == userID {
+			u.Interactive = len(q.tasks)
+			known = true
+		}
+		stats.Interactive += len(q.tasks)
+	}
+	for id, q := range s.classes[models.PriorityBatch].users {
+		if id == userID {
+			u.Batch = len(q.tasks)
+			known = true
+		}
+		stats.Batch += len(q.tasks)
+	}
+
+	stats.Users = []UserQueueStats{}
+	if known {
+		stats.Users = append(stats.Users, u)
+	}
+	return stats
+}
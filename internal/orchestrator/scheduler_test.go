@@ -0,0 +1,192 @@
+package orchestrator
+
+import (
+	"slices"
+	"testing"
+
+	"calculator/pkg/models"
+)
+
+// newTestScheduler - планировщик без выхода: задачи достаются из него через pop
+func newTestScheduler(weights map[int]float64) *scheduler {
+	s := newScheduler(nil, always)
+	s.configure(weights)
+	return s
+}
+
+// pushN ставит в очередь n задач выражения с id узлов 0..n-1
+func pushN(s *scheduler, exprID, user int, priority string, n int) {
+	for i := range n {
+		s.push(task{exprID: exprID, node: &models.AstNode{ID: i}, user: user, priority: priority})
+	}
+}
+
+// popUsers достает n задач и возвращает их пользователей по порядку
+func popUsers(t *testing.T, s *scheduler, n int) []int {
+	t.Helper()
+
+	users := make([]int, 0, n)
+	for range n {
+		next, ok := s.pop()
+		if !ok {
+			t.Fatalf("queue is empty after %d tasks, expected %d", len(users), n)
+		}
+		users = append(users, next.user)
+	}
+	return users
+}
+
+func count[T comparable](xs []T, x T) int {
+	n := 0
+	for _, y := range xs {
+		if y == x {
+			n++
+		}
+	}
+	return n
+}
+
+// большое выражение не задерживает задачи другого пользователя, пришедшие позже
+func TestSchedulerFair(t *testing.T) {
+	s := newTestScheduler(nil)
+	pushN(s, 1, 1, models.PriorityInteractive, 1000)
+	s.pop()
+	pushN(s, 2, 2, models.PriorityInteractive, 3)
+
+	users := popUsers(t, s, 6)
+	if count(users, 2) != 3 {
+		t.Errorf("first tasks went to users %v, expected user 2 to alternate with user 1", users)
+	}
+}
+
+func TestSchedulerWeights(t *testing.T) {
+	s := newTestScheduler(map[int]float64{1: 3})
+	pushN(s, 1, 1, models.PriorityInteractive, 40)
+	pushN(s, 2, 2, models.PriorityInteractive, 40)
+
+	users := popUsers(t, s, 20)
+	if n := count(users, 1); n != 15 {
+		t.Errorf("user 1 with weight 3 got %d of 20 tasks, expected 15: %v", n, users)
+	}
+}
+
+// задачи interactive уходят раньше batch, даже если пришли позже
+func TestSchedulerPriority(t *testing.T) {
+	s := newTestScheduler(nil)
+	pushN(s, 1, 1, models.PriorityBatch, 2)
+	pushN(s, 2, 2, models.PriorityInteractive, 2)
+	pushN(s, 3, 3, "", 1)
+
+	var got []string
+	for {
+		next, ok := s.pop()
+		if !ok {
+			break
+		}
+		got = append(got, next.priority)
+	}
+
+	// пустой приоритет - interactive
+	if len(got) != 5 || count(got[:3], models.PriorityBatch) != 0 || count(got[3:], models.PriorityBatch) != 2 {
+		t.Errorf("popped %v, expected three interactive tasks before two batch ones", got)
+	}
+}
+
+// задачи завершившихся выражений не отправляются
+func TestSchedulerRemove(t *testing.T) {
+	s := newTestScheduler(nil)
+	s.active = func(id int) bool { return id != 3 }
+	pushN(s, 1, 1, models.PriorityInteractive, 2)
+	pushN(s, 2, 1, models.PriorityBatch, 2)
+	pushN(s, 3, 2, models.PriorityInteractive, 2)
+	s.remove(1)
+
+	for range 2 {
+		if next, ok := s.pop(); !ok || next.exprID != 2 {
+			t.Fatalf("pop = %+v, %v; expected a task of expression 2", next, ok)
+		}
+	}
+	if next, ok := s.pop(); ok {
+		t.Errorf("pop = %+v; expected empty queue", next)
+	}
+}
+
+// постоянный поток interactive не останавливает batch: batch получает свою минимальную долю
+func TestSchedulerBatchShare(t *testing.T) {
+	s := newTestScheduler(nil)
+	pushN(s, 1, 1, models.PriorityInteractive, 3*batchEvery)
+	pushN(s, 2, 2, models.PriorityBatch, 3)
+
+	users := popUsers(t, s, 2*batchEvery)
+	if got := count(users, 2); got != 2 {
+		t.Errorf("popped %v, expected 2 batch tasks of user 2 in %d", users, 2*batchEvery)
+	}
+	if users[batchEvery-1] != 2 {
+		t.Errorf("popped %v, expected a batch task at position %d", users, batchEvery-1)
+	}
+
+	// без ожидающих batch задачи interactive идут подряд
+	pushN(s, 3, 1, models.PriorityInteractive, 2*batchEvery)
+	s.remove(2)
+	if users := popUsers(t, s, 2*batchEvery); count(users, 2) != 0 {
+		t.Errorf("popped %v, expected only interactive tasks", users)
+	}
+}
+
+// пользователь видит общую глубину очередей, но не очереди других пользователей
+func TestSchedulerStats(t *testing.T) {
+	s := newTestScheduler(map[int]float64{2: 2})
+	pushN(s, 1, 1, models.PriorityInteractive, 3)
+	pushN(s, 2, 2, models.PriorityBatch, 4)
+	s.pop()
+
+	tests := []struct {
+		user     int
+		expected []UserQueueStats
+	}{
+		{1, []UserQueueStats{{UserID: 1, Weight: 1, Interactive: 2, Dispatched: 1}}},
+		{2, []UserQueueStats{{UserID: 2, Weight: 2, Batch: 4}}},
+		{3, []UserQueueStats{}},
+	}
+
+	for _, tt := range tests {
+		stats := s.stats(tt.user)
+		if stats.Interactive != 2 || stats.Batch != 4 || !slices.Equal(stats.Users, tt.expected) {
+			t.Errorf("stats(%d) = %+v, expected 2 interactive, 4 batch and users %+v", tt.user, stats, tt.expected)
+		}
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected map[int]float64
+		err      bool
+	}{
+		{"", map[int]float64{}, false},
+		{"1=4", map[int]float64{1: 4}, false},
+		{"1=4, 7=2.5", map[int]float64{1: 4, 7: 2.5}, false},
+		{"1", nil, true},
+		{"x=2", nil, true},
+		{"1=0", nil, true},
+		{"1=-2", nil, true},
+		{"1=fast", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseWeights(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("parseWeights(%q) error = %v, expected error: %v", tt.s, err, tt.err)
+			continue
+		}
+		if len(got) != len(tt.expected) {
+			t.Errorf("parseWeights(%q) = %v, expected %v", tt.s, got, tt.expected)
+			continue
+		}
+		for user, w := range tt.expected {
+			if got[user] != w {
+				t.Errorf("parseWeights(%q) = %v, expected %v", tt.s, got, tt.expected)
+			}
+		}
+	}
+}
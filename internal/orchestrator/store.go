@@ -0,0 +1,146 @@
+package orchestrator
+
+// постоянное состояние выражений: дерево сохраняется при создании выражения, задачи - по ходу вычисления
+// после перезапуска оркестратор строит выражение из сохраненного дерева и подставляет уже
+// полученные результаты задач вместо повторной отправки агентам
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"calculator/internal/database"
+	"calculator/pkg/models"
+)
+
+// withStore сохраняет задачи выражения в db, nil - состояние только в памяти
+func (e *expression) withStore(db *database.DB) *expression {
+	e.db = db
+	return e
+}
+
+// withRecovered подставляет результаты задач, посчитанных до перезапуска
+// id узлов стабильны: дерево то же, а sendTasks обходит его в том же порядке
+func (e *expression) withRecovered(results []models.Result) *expression {
+	e.recovered = make(map[int]models.Result, len(results))
+	for _, res := range results {
+		e.recovered[res.ID] = res
+	}
+	return e
+}
+
+// recover подставляет результат узла, посчитанный до перезапуска
+func (e *expression) recover(node *models.AstNode) bool {
+	res, ok := e.recovered[node.ID]
+	if !ok {
+		return false
+	}
+	delete(e.recovered, node.ID)
+
+	res.ExpressionID = e.id
+	e.deleteAndUpdate(res)
+	return true
+}
+
+func (e *expression) queue(node *models.AstNode) {
+	if e.db == nil {
+		return
+	}
+	if err := e.db.QueueTask(context.Background(), e.id, node.ID, node.Value, operands(node)); err != nil {
+		log.Printf("expression %d: %v", e.id, err)
+	}
+}
+
+func (e *expression) finish(res models.Result) {
+	if e.db == nil {
+		return
+	}
+	if err := e.db.FinishTask(context.Background(), e.id, res); err != nil {
+		log.Printf("expression %d: %v", e.id, err)
+	}
+}
+
+// saveState сохраняет дерево выражения и его параметры до начала вычисления
+func saveState(ctx context.Context, db *database.DB, root *models.AstNode, state models.ExpressionState) error {
+	tree, err := json.Marshal(root)
+	if err != nil {
+		return fmt.Errorf("failed to encode tree: %w", err)
+	}
+	state.Tree = tree
+	return db.SaveExpressionState(ctx, state)
+}
+
+// restoreTree читает сохраненное дерево
+func restoreTree(data []byte) (*models.AstNode, error) {
+	var root models.AstNode
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to decode tree: %w", err)
+	}
+	return relink(&root, make(map[int]*models.AstNode)), nil
+}
+
+// relink снова делает общими узлы с одинаковым id: после оптимизатора дерево - DAG,
+// а в JSON общий узел записан столько раз, сколько у него родителей
+func relink(node *models.AstNode, seen map[int]*models.AstNode) *models.AstNode {
+	if same, ok := seen[node.ID]; ok {
+		return same
+	}
+	seen[node.ID] = node
+
+	if node.Left != nil {
+		node.Left = relink(node.Left, seen)
+	}
+	if node.Right != nil {
+		node.Right = relink(node.Right, seen)
+	}
+	for i, arg := range node.Args {
+		node.Args[i] = relink(arg, seen)
+	}
+	return node
+}
+
+// resume досчитывает выражения, которые считались до перезапуска
+// выражение без сохраненного дерева досчитать нельзя, оно завершается ошибкой
+func resume(db *database.DB) {
+	ctx := context.Background()
+	states, err := db.SelectUnfinishedExpressions(ctx)
+	if err != nil {
+		log.Printf("failed to resume expressions: %v", err)
+		return
+	}
+
+	for _, state := range states {
+		if err := resumeExpression(ctx, db, state); err != nil {
+			log.Printf("expression %d cannot be resumed: %v", state.ID, err)
+			if err := db.FailExpression(ctx, state.ID, "calculation was interrupted by an orchestrator restart"); err != nil {
+				log.Printf("expression %d: %v", state.ID, err)
+			}
+		}
+	}
+}
+
+func resumeExpression(ctx context.Context, db *database.DB, state models.ExpressionState) error {
+	if state.Tree == nil {
+		return fmt.Errorf("no saved tree")
+	}
+
+	root, err := restoreTree(state.Tree)
+	if err != nil {
+		return err
+	}
+	results, err := db.SelectTaskResults(ctx, state.ID)
+	if err != nil {
+		return err
+	}
+
+	// срок не продлевается: выражение, чей срок истек за время перезапуска, сразу получает timeout
+	e := NewExpression(state.ID, root).withPrecision(state.Precision).withDeadline(state.Deadline).
+		withOwner(state.UserID, state.Priority).withStore(db).withRecovered(results)
+	if !state.NoCache {
+		e.withCache(taskCache)
+	}
+	log.Printf("resuming expression %d with %d finished tasks", state.ID, len(results))
+	start(db, e)
+	return nil
+}
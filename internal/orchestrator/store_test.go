@@ -0,0 +1,85 @@
+package orchestrator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"calculator/pkg/ast"
+	"calculator/pkg/models"
+	"calculator/pkg/optimizer"
+)
+
+// после сохранения и чтения общий узел DAG снова один
+func TestRestoreTree(t *testing.T) {
+	fakeAgent()
+
+	node, err := ast.Build("(sqrt(16)+1)*(sqrt(16)+1)-sqrt(16)")
+	if err != nil {
+		t.Fatalf("ast.Build error: %v", err)
+	}
+	root := optimizer.Optimize(node, optimizer.Policy{Fold: optimizer.FoldNone, Dedupe: true}, models.Precision{})
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		t.Fatalf("json.Marshal error: %v", err)
+	}
+	restored, err := restoreTree(data)
+	if err != nil {
+		t.Fatalf("restoreTree error: %v", err)
+	}
+
+	if restored.Left.Left != restored.Left.Right {
+		t.Error("(sqrt(16)+1) should be a single node")
+	}
+	if restored.Right != restored.Left.Left.Left {
+		t.Error("sqrt(16) should be a single node")
+	}
+
+	result, err := calcTimeout(t, NewExpression(1, restored))
+	if err != nil || result != 21 {
+		t.Errorf("calc = %v, %v; expected 21", result, err)
+	}
+
+	if _, err := restoreTree([]byte("{")); err == nil {
+		t.Error("restoreTree of broken JSON expected error")
+	}
+}
+
+// выражение досчитывается с места остановки: посчитанные задачи агенту не уходят
+func TestCalcRecovered(t *testing.T) {
+	fakeAgent()
+
+	// (1+2)*sqrt(16): 1 - 0, 2 - 1, + - 2, 16 - 3, sqrt - 4, * - 5
+	tests := []struct {
+		name      string
+		recovered []models.Result
+		agent     bool // нужен ли агент для оставшихся задач
+	}{
+		{"nothing recovered", nil, true},
+		{"one branch", []models.Result{{ID: 2, Result: 3}}, true},
+		{"both branches", []models.Result{{ID: 2, Result: 3}, {ID: 4, Result: 4}}, true},
+		{"everything", []models.Result{{ID: 2, Result: 3}, {ID: 4, Result: 4}, {ID: 5, Result: 12}}, false},
+		// результат узла подставляется, только когда до него дойдет очередь
+		{"only root", []models.Result{{ID: 5, Result: 12}}, true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := ast.Build("(1+2)*sqrt(16)")
+			if err != nil {
+				t.Fatalf("ast.Build error: %v", err)
+			}
+
+			if !tt.agent {
+				resume := pauseFakeAgent()
+				defer resume()
+			}
+
+			e := NewExpression(100+i, node).withRecovered(tt.recovered)
+			result, err := calcTimeout(t, e)
+			if err != nil || result != 12 {
+				t.Errorf("calc = %v, %v; expected 12", result, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+-- Причина ошибки вычисления (например, ошибка области определения функции)
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS error TEXT;
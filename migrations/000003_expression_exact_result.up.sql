@@ -0,0 +1,2 @@
+-- Точный результат выражения в режиме decimal (десятичная строка)
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS exact_result TEXT;
@@ -0,0 +1,3 @@
+-- Результат выражения в режиме rational: несократимая дробь numerator/denominator
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS numerator NUMERIC;
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS denominator NUMERIC;
@@ -0,0 +1,7 @@
+-- Постоянный уровень кэша результатов задач: ключ - хэш режима чисел, оператора и операндов
+CREATE TABLE IF NOT EXISTS result_cache (
+    key TEXT PRIMARY KEY,
+    result DOUBLE PRECISION NOT NULL,
+    value TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+-- Каноническая запись выражения (ast.Unparse): одинаковые выражения записываются одинаково
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS normalized TEXT;
+CREATE INDEX IF NOT EXISTS expressions_user_normalized_idx ON expressions (user_id, normalized);
@@ -0,0 +1,26 @@
+-- Состояние выражения для продолжения после перезапуска оркестратора:
+-- дерево после оптимизатора и режим чисел
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS tree JSONB;
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS mode TEXT;
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS scale INTEGER;
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS rounding TEXT;
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS no_cache BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Задачи выражений, которые сейчас считаются; после завершения выражения его задачи удаляются
+CREATE TABLE IF NOT EXISTS tasks (
+    expression_id INTEGER NOT NULL REFERENCES expressions(id) ON DELETE CASCADE,
+    node_id INTEGER NOT NULL,
+    op TEXT NOT NULL,
+    args TEXT[] NOT NULL,
+    status TEXT NOT NULL CHECK(status IN ('queued', 'running', 'done', 'error')),
+    lease_owner TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    result DOUBLE PRECISION,
+    value TEXT,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (expression_id, node_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tasks_status ON tasks(status);
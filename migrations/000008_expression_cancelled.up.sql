@@ -0,0 +1,4 @@
+-- Статус cancelled: пользователь отменил выражение, оно больше не считается
+ALTER TABLE expressions DROP CONSTRAINT IF EXISTS expressions_status_check;
+ALTER TABLE expressions ADD CONSTRAINT expressions_status_check
+    CHECK(status IN ('pending', 'processing', 'done', 'error', 'cancelled'));
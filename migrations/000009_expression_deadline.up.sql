@@ -0,0 +1,6 @@
+-- Срок вычисления выражения и статус timeout для выражений, не посчитанных к сроку
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS deadline TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE expressions DROP CONSTRAINT IF EXISTS expressions_status_check;
+ALTER TABLE expressions ADD CONSTRAINT expressions_status_check
+    CHECK(status IN ('pending', 'processing', 'done', 'error', 'cancelled', 'timeout'));
@@ -0,0 +1,2 @@
+-- Класс приоритета выражения в планировщике задач: interactive или batch
+ALTER TABLE expressions ADD COLUMN IF NOT EXISTS priority TEXT;
@@ -1,70 +1,214 @@
 package ast
 
 import (
+	"fmt"
+
+	"calculator/pkg/functions"
 	"calculator/pkg/models"
 )
 
-var (
-	id int = 0
-)
+// builder собирает одно дерево и раздает id его узлам, начиная с 0
+// id уникальны только в пределах дерева, поэтому разборы не зависят друг от друга
+type builder struct {
+	id       int
+	symbolic bool // имена без значений становятся узлами variable, а не ошибкой
+}
+
+func (b *builder) nextID() int {
+	id := b.id
+	b.id++
+	return id
+}
 
 func priority(op string) (int, error) {
-	switch {
-	case op == "/" || op == "*":
+	switch op {
+	case "!":
+		return 10, nil
+	case "^":
+		return 9, nil
+	case models.Negation, models.Not:
+		return 8, nil
+	case "/", "*", "%", "//":
+		return 7, nil
+	case "+", "-":
+		return 6, nil
+	case "<", "<=", ">", ">=":
+		return 5, nil
+	case "==", "!=":
+		return 4, nil
+	case "&&":
 		return 3, nil
-	case op == "+" || op == "-":
+	case "||":
 		return 2, nil
-	case op == "(":
+	case "?", models.Ternary:
 		return 1, nil
+	case "(":
+		return 0, nil
 	default:
 		return 0, models.ErrUnknownOperator
 	}
 }
 
-func ast(tokens []*token) (*models.AstNode, error) {
+// правоассоциативные операторы: 2^3^2 = 2^(3^2), a ? b : c ? d : e = a ? b : (c ? d : e)
+func rightAssoc(op string) bool {
+	return op == "^" || op == "?" || op == models.Ternary
+}
+
+// checkCall проверяет имя функции и число аргументов
+// if - не функция реестра: его ветви считаются лениво
+func checkCall(name string, n int) error {
+	if name == models.Conditional {
+		if n != 3 {
+			return fmt.Errorf("%w: if expects 3 arguments, got %d", models.ErrArgumentsCount, n)
+		}
+		return nil
+	}
+	return functions.CheckArity(name, n)
+}
+
+func conditional(id int, args []*models.AstNode) *models.AstNode {
+	return &models.AstNode{
+		ID:      id,
+		AstType: "conditional",
+		Value:   models.Conditional,
+		Args:    args,
+	}
+}
+
+func (b *builder) ast(tokens []*token) (*models.AstNode, error) {
 	var stack []*models.AstNode
+	var firsts []*token // первые токены поддеревьев в стеке, нужны для позиции ошибки
 
 	for _, tok := range tokens {
 		switch tok.t {
 		case models.Operand:
 			// создаем узел для числа
 			node := &models.AstNode{
-				ID:      id,
+				ID:      b.nextID(),
 				AstType: "number",
 				Value:   tok.val,
 			}
 			stack = append(stack, node)
-			id++
+			firsts = append(firsts, tok)
 
 		case models.Operator:
+			if tok.val == models.Ternary {
+				// условие - три операнда
+				if len(stack) < 3 {
+					return nil, parseErr(models.ErrInvalidExpression, tok.pos, tok.size)
+				}
+
+				args := make([]*models.AstNode, 3)
+				copy(args, stack[len(stack)-3:])
+				stack = stack[:len(stack)-3]
+				first := firsts[len(firsts)-3]
+				firsts = firsts[:len(firsts)-3]
+
+				stack = append(stack, conditional(b.nextID(), args))
+				firsts = append(firsts, first)
+				break
+			}
+
 			// один оператор - два операнда
 			if len(stack) < 2 {
-				return nil, models.ErrInvalidExpression
+				return nil, parseErr(models.ErrInvalidExpression, tok.pos, tok.size)
 			}
 
 			// извлекаем правый и левый операнды (порядок важен)
 			right := stack[len(stack)-1]
 			left := stack[len(stack)-2]
 			stack = stack[:len(stack)-2]
+			first := firsts[len(firsts)-2]
+			firsts = firsts[:len(firsts)-2]
 
 			// создаем новый узел операции для оператора
 			node := &models.AstNode{
-				ID:      id,
+				ID:      b.nextID(),
 				AstType: "operation",
 				Value:   tok.val,
 				Left:    left,
 				Right:   right,
 			}
 			stack = append(stack, node)
-			id++
+			firsts = append(firsts, first)
+
+		case models.UnaryOperator:
+			// унарный оператор - один операнд
+			if len(stack) < 1 {
+				return nil, parseErr(models.ErrInvalidExpression, tok.pos, tok.size)
+			}
+
+			operand := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			firsts = firsts[:len(firsts)-1]
+
+			node := &models.AstNode{
+				ID:      b.nextID(),
+				AstType: "operation",
+				Value:   tok.val,
+				Left:    operand,
+			}
+			stack = append(stack, node)
+			firsts = append(firsts, tok)
+
+		case models.Postfix:
+			// постфиксный оператор - один операнд, поддерево начинается с операнда
+			if len(stack) < 1 {
+				return nil, parseErr(models.ErrInvalidExpression, tok.pos, tok.size)
+			}
+
+			node := &models.AstNode{
+				ID:      b.nextID(),
+				AstType: "operation",
+				Value:   tok.val,
+				Left:    stack[len(stack)-1],
+			}
+			stack[len(stack)-1] = node
+
+		case models.Function:
+			// функция - столько операндов, сколько аргументов насчитал rpn
+			if err := checkCall(tok.val, tok.args); err != nil {
+				return nil, parseErr(err, tok.pos, tok.size)
+			}
+			if len(stack) < tok.args {
+				return nil, parseErr(models.ErrInvalidExpression, tok.pos, tok.size)
+			}
+
+			args := make([]*models.AstNode, tok.args)
+			copy(args, stack[len(stack)-tok.args:])
+			stack = stack[:len(stack)-tok.args]
+			firsts = firsts[:len(firsts)-tok.args]
+
+			node := &models.AstNode{
+				ID:      b.nextID(),
+				AstType: "function",
+				Value:   tok.val,
+				Args:    args,
+			}
+			if tok.val == models.Conditional {
+				node = conditional(node.ID, args)
+			}
+			stack = append(stack, node)
+			firsts = append(firsts, tok)
+
+		case models.Identifier:
+			if !b.symbolic {
+				return nil, parseErr(&models.UnboundVariableError{Name: tok.val}, tok.pos, tok.size)
+			}
+			stack = append(stack, &models.AstNode{ID: b.nextID(), AstType: "variable", Value: tok.val})
+			firsts = append(firsts, tok)
 
 		default:
-			return nil, models.ErrWrongCharacter
+			return nil, parseErr(models.ErrWrongCharacter, tok.pos, tok.size)
 		}
 	}
 
-	if len(stack) != 1 {
-		return nil, models.ErrInvalidExpression
+	if len(stack) == 0 {
+		return nil, parseErr(models.ErrInvalidExpression, 0, 0)
+	}
+	// лишнее поддерево - операнд, перед которым нет оператора
+	if len(stack) > 1 {
+		return nil, parseErr(models.ErrInvalidExpression, firsts[1].pos, firsts[1].size)
 	}
 
 	return stack[0], nil
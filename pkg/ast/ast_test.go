@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"errors"
 	"testing"
 
 	"calculator/pkg/models"
@@ -12,12 +13,26 @@ func TestPriority(t *testing.T) {
 		expected int
 		err      error
 	}{
-		{"/", 3, nil},
-		{"*", 3, nil},
-		{"+", 2, nil},
-		{"-", 2, nil},
-		{"(", 1, nil},
-		{"?", 0, models.ErrUnknownOperator},
+		{"!", 10, nil},
+		{"^", 9, nil},
+		{models.Negation, 8, nil},
+		{models.Not, 8, nil},
+		{"/", 7, nil},
+		{"*", 7, nil},
+		{"%", 7, nil},
+		{"//", 7, nil},
+		{"+", 6, nil},
+		{"-", 6, nil},
+		{"<", 5, nil},
+		{">=", 5, nil},
+		{"==", 4, nil},
+		{"!=", 4, nil},
+		{"&&", 3, nil},
+		{"||", 2, nil},
+		{"?", 1, nil},
+		{models.Ternary, 1, nil},
+		{"(", 0, nil},
+		{"=", 0, models.ErrUnknownOperator},
 	}
 
 	for _, tt := range tests {
@@ -35,6 +50,14 @@ func compareAstNodes(a, b *models.AstNode) bool {
 	if a == nil || b == nil {
 		return false
 	}
+	if len(a.Args) != len(b.Args) {
+		return false
+	}
+	for i := range a.Args {
+		if !compareAstNodes(a.Args[i], b.Args[i]) {
+			return false
+		}
+	}
 	return a.AstType == b.AstType &&
 		a.Value == b.Value &&
 		compareAstNodes(a.Left, b.Left) &&
@@ -94,12 +117,40 @@ func TestAst(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			name: "unary minus",
+			tokens: []*token{
+				{t: models.Operand, val: "3"},
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operand, val: "5"},
+				{t: models.Operator, val: "+"},
+			},
+			expected: &models.AstNode{
+				AstType: "operation",
+				Value:   "+",
+				Left: &models.AstNode{
+					AstType: "operation",
+					Value:   models.Negation,
+					Left:    &models.AstNode{AstType: "number", Value: "3"},
+				},
+				Right: &models.AstNode{AstType: "number", Value: "5"},
+			},
+			err: nil,
+		},
+		{
+			name: "unary minus without operand",
+			tokens: []*token{
+				{t: models.UnaryOperator, val: models.Negation},
+			},
+			expected: nil,
+			err:      models.ErrInvalidExpression,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result, err := ast(tt.tokens)
-			if err != tt.err {
+			result, err := new(builder).ast(tt.tokens)
+			if !errors.Is(err, tt.err) {
 				t.Errorf("ast() error = %v, expected %v", err, tt.err)
 			}
 			if !compareAstNodes(result, tt.expected) {
@@ -3,37 +3,209 @@ package ast
 // модуль, преобразующий строку-выражение в ast
 
 import (
+	"errors"
+	"fmt"
 	"strings"
-	"sync"
 
 	"calculator/pkg/models"
 )
 
-var (
-	mu sync.Mutex
+// Syntax - набор правил записи выражений
+type Syntax string
+
+const (
+	SyntaxStandard Syntax = "standard" // каждый оператор записан явно
+	SyntaxMath     Syntax = "math"     // как в учебнике: 2(3+4), (1+2)(3+4), 3pi
 )
 
+// ParseSyntax проверяет название синтаксиса из запроса, пустое название - стандартный
+func ParseSyntax(name string) (Syntax, error) {
+	switch Syntax(name) {
+	case "", SyntaxStandard:
+		return SyntaxStandard, nil
+	case SyntaxMath:
+		return SyntaxMath, nil
+	default:
+		return "", fmt.Errorf("%w: %s", models.ErrUnknownSyntax, name)
+	}
+}
+
+// Parser разбирает выражения в дерево
+// Parser не меняется при разборе, поэтому один Parser можно использовать из нескольких горутин
+type Parser struct {
+	Variables map[string]float64 // значения переменных, перекрывают встроенные константы
+	Syntax    Syntax             // пустой Syntax - стандартный
+	Exact     bool               // точный режим (decimal, rational): литералы не ограничены диапазоном float64
+}
+
+// implicit - разрешено ли пропускать знак умножения
+func (p *Parser) implicit() bool {
+	return p.Syntax == SyntaxMath
+}
+
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// Build строит дерево выражения, id узлов начинаются с 0
+// ошибки разбора возвращаются как *models.ParseError с позицией в исходном выражении
+func (p *Parser) Build(expression string) (*models.AstNode, error) {
+	stripped, offsets := strip(expression) // избавляемся от пробелов
+
+	astRoot, _, err := p.build(stripped)
+	if err != nil {
+		return nil, locate(err, expression, offsets)
+	}
+
+	return astRoot, nil
+}
+
+// Tree - дерево выражения вместе с обратной польской записью, из которой оно построено
+type Tree struct {
+	Root     *models.AstNode
+	RPN      []string        // токены после сортировочной станции: числа, операторы, имена функций
+	Symbolic *models.AstNode // то же дерево, но переменные и константы в нем - узлы variable с именем
+}
+
+// Parse строит дерево, как Build, и возвращает промежуточную запись для отладки разбора
+// и дерево с именами переменных для записи выражения
+func (p *Parser) Parse(expression string) (*Tree, error) {
+	stripped, offsets := strip(expression)
+
+	astRoot, rpn, err := p.build(stripped)
+	if err != nil {
+		return nil, locate(err, expression, offsets)
+	}
+	symbolic, err := p.symbolic(stripped)
+	if err != nil {
+		return nil, locate(err, expression, offsets)
+	}
+
+	tree := &Tree{Root: astRoot, RPN: make([]string, len(rpn)), Symbolic: symbolic}
+	for i, tok := range rpn {
+		tree.RPN[i] = tok.val
+	}
+	return tree, nil
+}
+
 func Build(expression string) (*models.AstNode, error) {
-	mu.Lock()
-	defer mu.Unlock()
-	expression = strings.ReplaceAll(expression, " ", "") // избавляемся от пробелов
+	return NewParser().Build(expression)
+}
+
+// BuildWithVariables строит дерево, подставляя вместо имен значения из vars и встроенные константы
+func BuildWithVariables(expression string, vars map[string]float64) (*models.AstNode, error) {
+	return (&Parser{Variables: vars}).Build(expression)
+}
 
-	err := expErr(expression)
+func (p *Parser) build(expression string) (*models.AstNode, []*token, error) {
+	err := expErr(expression, p.implicit())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	tokens := tokens(expression)
+	tokens, err := tokens(expression)
+	if err != nil {
+		return nil, nil, err
+	}
+	if errs := outOfRange(tokens, p.Exact); len(errs) > 0 {
+		return nil, nil, errs[0]
+	}
+	if p.implicit() {
+		tokens = implicitMultiplication(tokens, p.Variables)
+	}
+	if err := missingOperator(tokens); err != nil {
+		return nil, nil, err
+	}
+	if err := bind(tokens, p.Variables); err != nil {
+		return nil, nil, err
+	}
 
 	rpn, err := rpn(tokens)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	astRoot, err := new(builder).ast(rpn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return astRoot, rpn, nil
+}
+
+// symbolic строит дерево без подстановки значений: имена остаются в нем узлами variable
+// выражение уже прошло build, поэтому проверки ошибок здесь не повторяются
+func (p *Parser) symbolic(expression string) (*models.AstNode, error) {
+	tokens, err := tokens(expression)
 	if err != nil {
 		return nil, err
 	}
+	if p.implicit() {
+		tokens = implicitMultiplication(tokens, p.Variables)
+	}
 
-	astRoot, err := ast(rpn)
+	rpn, err := rpn(tokens)
 	if err != nil {
 		return nil, err
 	}
+	return (&builder{symbolic: true}).ast(rpn)
+}
 
-	return astRoot, nil
+// parseErr привязывает ошибку к фрагменту выражения
+func parseErr(err error, pos, size int) error {
+	return &models.ParseError{Err: err, Position: pos, Length: size}
+}
+
+// strip убирает пробелы и запоминает, где в исходной строке стоял каждый оставшийся байт
+// пробел остается (один), если без него соседние токены слились бы в один: 1 2, sqrt 4, 3! == 6, * *
+func strip(expression string) (string, []int) {
+	var b strings.Builder
+	offsets := make([]int, 0, len(expression)+1)
+
+	for i := 0; i < len(expression); i++ {
+		if expression[i] == ' ' {
+			j := i
+			for j < len(expression) && expression[j] == ' ' {
+				j++
+			}
+			if b.Len() > 0 && j < len(expression) && merges(b.String()[b.Len()-1], expression[j]) {
+				b.WriteByte(' ')
+				offsets = append(offsets, i)
+			}
+			i = j - 1
+			continue
+		}
+		b.WriteByte(expression[i])
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(expression)) // позиция конца строки
+
+	return b.String(), offsets
+}
+
+// merges - слились бы символы a и b в один токен, если убрать пробел между ними
+func merges(a, b byte) bool {
+	word := func(c byte) bool { return isName(c) || c == '.' }
+	return (word(a) && word(b)) || len(operatorAt(string([]byte{a, b}), 0)) == 2
+}
+
+// locate переводит позицию ошибки из строки без пробелов в исходное выражение
+func locate(err error, expression string, offsets []int) error {
+	var pe *models.ParseError
+	if !errors.As(err, &pe) {
+		return err
+	}
+
+	last := len(offsets) - 1
+	start := offsets[min(pe.Position, last)]
+	end := start
+	if pe.Length > 0 {
+		end = offsets[min(pe.Position+pe.Length-1, last)] + 1
+	}
+	end = min(end, len(expression))
+
+	pe.Position = start
+	pe.Length = end - start
+	pe.Token = expression[start:end]
+	return pe
 }
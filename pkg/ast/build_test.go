@@ -0,0 +1,468 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"calculator/pkg/models"
+)
+
+func TestBuildFunctions(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   *models.AstNode
+		err        error
+	}{
+		{
+			expression: "sqrt(16)",
+			expected: &models.AstNode{
+				AstType: "function",
+				Value:   "sqrt",
+				Args:    []*models.AstNode{{AstType: "number", Value: "16"}},
+			},
+		},
+		{
+			expression: "max(1,2*3,-4)",
+			expected: &models.AstNode{
+				AstType: "function",
+				Value:   "max",
+				Args: []*models.AstNode{
+					{AstType: "number", Value: "1"},
+					{
+						AstType: "operation",
+						Value:   "*",
+						Left:    &models.AstNode{AstType: "number", Value: "2"},
+						Right:   &models.AstNode{AstType: "number", Value: "3"},
+					},
+					{
+						AstType: "operation",
+						Value:   models.Negation,
+						Left:    &models.AstNode{AstType: "number", Value: "4"},
+					},
+				},
+			},
+		},
+		{
+			expression: "1+round(2.5,min(1,2))",
+			expected: &models.AstNode{
+				AstType: "operation",
+				Value:   "+",
+				Left:    &models.AstNode{AstType: "number", Value: "1"},
+				Right: &models.AstNode{
+					AstType: "function",
+					Value:   "round",
+					Args: []*models.AstNode{
+						{AstType: "number", Value: "2.5"},
+						{
+							AstType: "function",
+							Value:   "min",
+							Args: []*models.AstNode{
+								{AstType: "number", Value: "1"},
+								{AstType: "number", Value: "2"},
+							},
+						},
+					},
+				},
+			},
+		},
+		{expression: "sqrt(1,2)", err: models.ErrArgumentsCount},
+		{expression: "foo(1)", err: models.ErrUnknownFunction},
+		{expression: "(1,2)+3", err: models.ErrMisplacedComma},
+		{expression: "sqrt+1", err: models.ErrUnboundVariable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			result, err := Build(tt.expression)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Build(%s) error = %v, expected %v", tt.expression, err, tt.err)
+			}
+			if !compareAstNodes(result, tt.expected) {
+				t.Errorf("Build(%s) = %v, expected %v", tt.expression, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildWithVariables(t *testing.T) {
+	vars := map[string]float64{"rate": 0.05, "principal": 1000, "e": 2}
+
+	tests := []struct {
+		expression string
+		expected   *models.AstNode
+		err        error
+	}{
+		{
+			expression: "rate*principal",
+			expected: &models.AstNode{
+				AstType: "operation",
+				Value:   "*",
+				Left:    &models.AstNode{AstType: "number", Value: "0.05"},
+				Right:   &models.AstNode{AstType: "number", Value: "1000"},
+			},
+		},
+		{
+			// переменная запроса перекрывает константу
+			expression: "2*pi+e",
+			expected: &models.AstNode{
+				AstType: "operation",
+				Value:   "+",
+				Left: &models.AstNode{
+					AstType: "operation",
+					Value:   "*",
+					Left:    &models.AstNode{AstType: "number", Value: "2"},
+					Right:   &models.AstNode{AstType: "number", Value: "3.141592653589793"},
+				},
+				Right: &models.AstNode{AstType: "number", Value: "2"},
+			},
+		},
+		{expression: "rate*years", err: models.ErrUnboundVariable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			result, err := BuildWithVariables(tt.expression, vars)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("BuildWithVariables(%s) error = %v, expected %v", tt.expression, err, tt.err)
+			}
+			if !compareAstNodes(result, tt.expected) {
+				t.Errorf("BuildWithVariables(%s) = %v, expected %v", tt.expression, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnboundVariableName(t *testing.T) {
+	_, err := Build("x+1")
+
+	var unbound *models.UnboundVariableError
+	if !errors.As(err, &unbound) {
+		t.Fatalf("Build(x+1) error = %v, expected UnboundVariableError", err)
+	}
+	if unbound.Name != "x" || unbound.Error() != "unbound variable: x" {
+		t.Errorf("Build(x+1) error = %q (name %q), expected \"unbound variable: x\"", unbound.Error(), unbound.Name)
+	}
+}
+
+func TestBuildErrorPosition(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        error
+		position   int
+		token      string
+		snippet    string
+	}{
+		{"2+*3", models.ErrMergedOperators, 2, "*", "2+*3\n  ^"},
+		{"2 + * 3", models.ErrMergedOperators, 4, "*", "2 + * 3\n    ^"},
+		{"(1+2", models.ErrNotClosedBracket, 0, "(", "(1+2\n^"},
+		{"(1+2))+(3", models.ErrNotOpenedBracket, 5, ")", "(1+2))+(3\n     ^"},
+		{"1 + 2 #", models.ErrWrongCharacter, 6, "#", "1 + 2 #\n      ^"},
+		{"1 + sqrt(1, 2)", models.ErrArgumentsCount, 4, "sqrt", "1 + sqrt(1, 2)\n    ^^^^"},
+		{"2 * rate", models.ErrUnboundVariable, 4, "rate", "2 * rate\n    ^^^^"},
+		{"2 ** *3", models.ErrMergedOperators, 5, "*", "2 ** *3\n     ^"},
+		{"1 + 2 sqrt(4)", models.ErrInvalidExpression, 6, "sqrt", "1 + 2 sqrt(4)\n      ^^^^"},
+		{"1 + 1.2.3", models.ErrMalformedNumber, 4, "1.2.3", "1 + 1.2.3\n    ^^^^^"},
+		{"2*0x1G", models.ErrMalformedNumber, 2, "0x1G", "2*0x1G\n  ^^^^"},
+		{"0b102+1", models.ErrMalformedNumber, 0, "0b102", "0b102+1\n^^^^^"},
+		{"1__000", models.ErrMalformedNumber, 0, "1__000", "1__000\n^^^^^^"},
+		{"1_+2", models.ErrMalformedNumber, 0, "1_", "1_+2\n^^"},
+		{"2+0x", models.ErrMalformedNumber, 2, "0x", "2+0x\n  ^^"},
+		{"1e999*2", models.ErrMalformedNumber, 0, "1e999", "1e999*2\n^^^^^"},
+		{"2*1.5e", models.ErrMalformedNumber, 2, "1.5e", "2*1.5e\n  ^^^^"},
+		{"1 2", models.ErrInvalidExpression, 2, "2", "1 2\n  ^"},
+		{"2 3 + 1", models.ErrInvalidExpression, 2, "3", "2 3 + 1\n  ^"},
+		{"sqrt 4", models.ErrInvalidExpression, 5, "4", "sqrt 4\n     ^"},
+		{"2 * * 3", models.ErrMergedOperators, 4, "*", "2 * * 3\n    ^"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Build(tt.expression)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Build(%s) error = %v, expected %v", tt.expression, err, tt.err)
+			}
+
+			var pe *models.ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Build(%s) error = %v, expected ParseError", tt.expression, err)
+			}
+			if pe.Position != tt.position || pe.Token != tt.token {
+				t.Errorf("Build(%s) position = %d, token = %q, expected %d, %q", tt.expression, pe.Position, pe.Token, tt.position, tt.token)
+			}
+			if snippet := pe.Snippet(tt.expression); snippet != tt.snippet {
+				t.Errorf("Build(%s) snippet = %q, expected %q", tt.expression, snippet, tt.snippet)
+			}
+		})
+	}
+}
+
+// диапазон литералов зависит от режима: 1e400 не помещается во float64, но допустим в точных режимах
+func TestBuildLiteralRange(t *testing.T) {
+	tests := []struct {
+		expression string
+		exact      bool
+		expected   string // значение литерала, пустое - ошибка malformed_number
+	}{
+		{"1e400", false, ""},
+		{"1e400", true, "1e400"},
+		{"-1e-400", true, "1e-400"},
+		{"1e1000000", true, ""},
+		{"0x1_0000_0000_0000_0000", false, "18446744073709551616"},
+		{"0x1_0000_0000_0000_0000", true, "18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s exact=%v", tt.expression, tt.exact), func(t *testing.T) {
+			root, err := (&Parser{Exact: tt.exact}).Build(tt.expression)
+			if tt.expected == "" {
+				if !errors.Is(err, models.ErrMalformedNumber) {
+					t.Errorf("Build(%s) error = %v, expected %v", tt.expression, err, models.ErrMalformedNumber)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.expression, err)
+			}
+			if root.AstType != "number" {
+				root = root.Left // унарный минус
+			}
+			if root.Value != tt.expected {
+				t.Errorf("Build(%s) = %s, expected %s", tt.expression, root.Value, tt.expected)
+			}
+		})
+	}
+}
+
+// каждый код ошибки разбора возвращается для того ввода, который он описывает
+func TestParseErrorCode(t *testing.T) {
+	tests := []struct {
+		expression string
+		code       string
+	}{
+		{"*2", "operator_first"},
+		{"2+", "operator_last"},
+		{"2+()", "empty_brackets"},
+		{"(1)(2)", "merged_brackets"},
+		{"2+*3", "merged_operators"},
+		{"2#3", "wrong_character"},
+		{"2(3)", "invalid_expression"},
+		{"(1+2))", "not_opened_bracket"},
+		{"(1+2", "not_closed_bracket"},
+		{"-", "no_operands"},
+		{"(-)", "no_operands"},
+		{"foo(1)", "unknown_function"},
+		{"x+1", "unbound_variable"},
+		{"sqrt(1, 2)", "arguments_count"},
+		{"1,2", "misplaced_comma"},
+		{"1.2.3", "malformed_number"},
+		{"1e", "malformed_number"},
+		{"1.5E+x", "malformed_number"},
+		{"1?2", "unbalanced_conditional"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Build(tt.expression)
+			var pe *models.ParseError
+			if !errors.As(err, &pe) {
+				t.Fatalf("Build(%s) error = %v, expected ParseError", tt.expression, err)
+			}
+			if pe.Code() != tt.code {
+				t.Errorf("Build(%s) code = %s (%v), expected %s", tt.expression, pe.Code(), err, tt.code)
+			}
+		})
+	}
+
+	// в математической записи 2e - это 2*e
+	if _, err := (&Parser{Syntax: SyntaxMath}).Build("2e"); err != nil {
+		t.Errorf("Build(2e) in math syntax error = %v", err)
+	}
+}
+
+// collectIDs обходит дерево и собирает id узлов
+func collectIDs(node *models.AstNode, ids map[int]bool) {
+	if node == nil {
+		return
+	}
+	ids[node.ID] = true
+	collectIDs(node.Left, ids)
+	collectIDs(node.Right, ids)
+	for _, arg := range node.Args {
+		collectIDs(arg, ids)
+	}
+}
+
+// приоритеты %, // и !: дерево совпадает с деревом записи со скобками
+func TestBuildIntegerOperators(t *testing.T) {
+	tests := []struct {
+		expression string
+		explicit   string
+	}{
+		{"7//2*3", "(7//2)*3"},
+		{"1+7%3", "1+(7%3)"},
+		{"8%3//2", "(8%3)//2"},
+		{"2^3!", "2^(3!)"},
+		{"-3!", "-(3!)"},
+		{"3!^2", "(3!)^2"},
+		{"(1+2)!!", "((1+2)!)!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := Build(tt.expression)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.expression, err)
+			}
+			expected, err := Build(tt.explicit)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.explicit, err)
+			}
+			if !compareAstNodes(got, expected) {
+				t.Errorf("Build(%s) = %+v, expected tree of %s", tt.expression, got, tt.explicit)
+			}
+		})
+	}
+
+	// факториал после операнда без оператора - пропущен оператор
+	if _, err := Build("3!2"); !errors.Is(err, models.ErrInvalidExpression) {
+		t.Errorf("Build(3!2) error = %v, expected %v", err, models.ErrInvalidExpression)
+	}
+}
+
+func TestBuildConditionals(t *testing.T) {
+	tests := []struct {
+		expression string
+		explicit   string
+	}{
+		{"1+2<3*4", "(1+2)<(3*4)"},
+		{"1<2==1", "(1<2)==1"},
+		{"1||0&&0", "1||(0&&0)"},
+		{"!1==0", "(!1)==0"},
+		{"!-1", "!(-1)"},
+		{"3!=3", "3 != 3"},
+		// после операнда !== - факториал и ==
+		{"3! == 6", "(3!)==6"},
+		{"3!==6", "(3!)==6"},
+		{"3!!==6", "((3!)!)==6"},
+		{"1?2:3?4:5", "1?2:(3?4:5)"},
+		{"1?2?3:4:5", "1?(2?3:4):5"},
+		{"1>0?1+1:2*2", "(1>0)?(1+1):(2*2)"},
+		{"if(1>0, 2, 3)", "1>0?2:3"},
+		{"max(1?2:3, 4)", "max((1?2:3), 4)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := Build(tt.expression)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.expression, err)
+			}
+			expected, err := Build(tt.explicit)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.explicit, err)
+			}
+			if !compareAstNodes(got, expected) {
+				t.Errorf("Build(%s) = %+v, expected tree of %s", tt.expression, got, tt.explicit)
+			}
+		})
+	}
+
+	errs := []struct {
+		expression string
+		err        error
+	}{
+		{"1?2+3", models.ErrUnbalancedTernary},
+		{"1+2:3", models.ErrUnbalancedTernary},
+		{"(1?2):3", models.ErrUnbalancedTernary},
+		{"max(1?2, 3)", models.ErrUnbalancedTernary},
+		{"if(1, 2)", models.ErrArgumentsCount},
+	}
+	for _, tt := range errs {
+		if _, err := Build(tt.expression); !errors.Is(err, tt.err) {
+			t.Errorf("Build(%s) error = %v, expected %v", tt.expression, err, tt.err)
+		}
+	}
+}
+
+// в математическом синтаксисе дерево совпадает с деревом явной записи
+func TestBuildMathSyntax(t *testing.T) {
+	tests := []struct {
+		implicit string
+		explicit string
+	}{
+		{"2(3+4)", "2*(3+4)"},
+		{"(1+2)(3+4)", "(1+2)*(3+4)"},
+		{"3pi", "3*pi"},
+		{"2x^2", "2*x^2"},
+		{"(x)2", "(x)*2"},
+		{"2sqrt(4)", "2*sqrt(4)"},
+		{"pi(1+x)", "pi*(1+x)"},
+		{"-2(3)", "-2*(3)"},
+		{"1/2(3)", "1/2*(3)"},
+		{"2 x+1", "2*x+1"},
+		{"2 3", "2*3"},
+		{"x x", "x*x"},
+	}
+
+	vars := map[string]float64{"x": 5}
+	for _, tt := range tests {
+		t.Run(tt.implicit, func(t *testing.T) {
+			got, err := (&Parser{Variables: vars, Syntax: SyntaxMath}).Build(tt.implicit)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.implicit, err)
+			}
+			expected, err := BuildWithVariables(tt.explicit, vars)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.explicit, err)
+			}
+			if !compareAstNodes(got, expected) {
+				t.Errorf("Build(%s) = %+v, expected tree of %s", tt.implicit, got, tt.explicit)
+			}
+		})
+	}
+
+	// без математического синтаксиса пропуск оператора - ошибка
+	for _, expression := range []string{"2(3+4)", "(1+2)(3+4)", "3pi", "2 3", "x x"} {
+		if _, err := Build(expression); err == nil {
+			t.Errorf("Build(%s) expected error in standard syntax", expression)
+		}
+	}
+}
+
+func TestParserConcurrent(t *testing.T) {
+	parser := NewParser()
+	parser.Variables = map[string]float64{"x": 2}
+
+	const expression = "1+x*3-max(4,-5)"
+	const nodes = 10
+
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			node, err := parser.Build(expression)
+			if err != nil {
+				t.Errorf("Build(%s) error: %v", expression, err)
+				return
+			}
+
+			// у каждого дерева свои id: от 0 до числа узлов, без пропусков и повторов
+			ids := make(map[int]bool)
+			collectIDs(node, ids)
+			for id := range nodes {
+				if !ids[id] {
+					t.Errorf("Build(%s) ids = %v, expected 0..%d", expression, ids, nodes-1)
+					return
+				}
+			}
+			if len(ids) != nodes {
+				t.Errorf("Build(%s) ids = %v, expected 0..%d", expression, ids, nodes-1)
+			}
+		}()
+	}
+	wg.Wait()
+}
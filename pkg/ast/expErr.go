@@ -1,61 +1,172 @@
 package ast
 
-import "calculator/pkg/models"
+import (
+	"strings"
+	"unicode/utf8"
+
+	"calculator/pkg/models"
+)
+
+// операторы выражения; двухсимвольные стоят раньше, чтобы находиться первыми
+var operators = []string{"**", "//", "<=", ">=", "==", "!=", "&&", "||", "+", "-", "*", "/", "^", "%", "<", ">", "!", "?", ":"}
+
+// operatorAt возвращает оператор, который начинается с позиции i, или пустую строку
+func operatorAt(str string, i int) string {
+	for _, op := range operators {
+		if strings.HasPrefix(str[i:], op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// operatorAfter - оператор с позиции i с учетом того, закончился ли перед ним операнд:
+// после операнда !== - это факториал и ==, а не != и лишний =: 3!==6 - это 3! == 6
+func operatorAfter(str string, i int, operand bool) string {
+	if operand && strings.HasPrefix(str[i:], "!==") {
+		return "!"
+	}
+	return operatorAt(str, i)
+}
+
+// операторы, которые не могут быть унарными
+func binaryOnly(op string) bool {
+	return op != "" && op != "+" && op != "-" && op != "!"
+}
+
+func isName(c byte) bool {
+	return letter(c) || ('0' <= c && c <= '9')
+}
+
+// hasOperand - есть ли в выражении операнд: число или имя переменной
+func hasOperand(expression string) bool {
+	for i := 0; i < len(expression); i++ {
+		if isName(expression[i]) {
+			return true
+		}
+	}
+	return false
+}
 
 // первоначальная проверка на ошибки
 // понижает шанс пропустить ошибку в выражении
-func expErr(expression string) error {
-	len := len(expression)
-	flag := false
+// при implicit скобки подряд разрешены: (1+2)(3+4) - это умножение
+func expErr(expression string, implicit bool) error {
+	if errs := expErrs(expression, false, implicit); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// expErrs собирает ошибки выражения; если all == false, останавливается на первой
+func expErrs(expression string, all, implicit bool) []error {
+	var errs []error
+	length := len(expression)
+	flag := hasOperand(expression)
+	// в выражении из одних операторов и скобок (-, ---, (-)) ошибка не в отдельном символе, а в отсутствии операндов
+	if !flag && !all {
+		return append(errs, parseErr(models.ErrNoOperators, 0, length))
+	}
+	operand := false           // закончился ли перед текущим символом операнд
+	opened := make([]int, 0)   // позиции незакрытых скобок
+	unopened := make([]int, 0) // позиции лишних закрывающих скобок
 	start := 0
 	end := 0
 
-	for i := 0; i < len; i++ {
+	for i := 0; i < length; i++ {
+		pos := i
 		curr := expression[i]
+		first := i == 0
+		// пробел, оставшийся после strip, только разделяет токены
+		if curr == ' ' {
+			continue
+		}
+
+		// многосимвольные операторы (**, //, <=, && ...) проверяем целиком
+		op := operatorAfter(expression, i, operand)
+		size := max(len(op), 1)
+		i += size - 1
+
 		next := byte(0)
-		if i < len-1 {
-			next = expression[i+1]
+		nextOp := ""
+		nextPos := i + 1
+		if nextPos < length {
+			if expression[nextPos] == ' ' {
+				nextPos++ // пробел не стоит в конце строки: strip оставляет его только между символами
+			}
+			next = expression[nextPos]
+			nextOp = operatorAt(expression, nextPos)
 		}
 
+		// ! после операнда - факториал, он продолжает операнд, а не требует его
+		isOp := op != "" && !(op == "!" && operand)
+
 		if curr == '(' {
 			start++
+			opened = append(opened, pos)
 		}
 		if curr == ')' {
 			end++
-		}
-		if 48 <= curr && curr <= 57 && !flag {
-			flag = true
+			if len(opened) > 0 {
+				opened = opened[:len(opened)-1]
+			} else {
+				unopened = append(unopened, pos)
+			}
 		}
 
+		var err error
 		switch {
-		case i == 0 && (curr == ')' || curr == '*' || curr == '+' || curr == '-' || curr == '/'):
-			return models.ErrOperatorFirst
-		case i == len-1 && (curr == '*' || curr == '+' || curr == '-' || curr == '/'):
-			return models.ErrOperatorLast
+		case curr == ',' && (first || i == length-1 || next == ')' || next == ',' || binaryOnly(nextOp)):
+			err = parseErr(models.ErrMisplacedComma, pos, 1)
+		case (curr == '(' || isOp) && next == ',':
+			err = parseErr(models.ErrMisplacedComma, nextPos, 1)
+		case first && (curr == ')' || binaryOnly(op)):
+			err = parseErr(models.ErrOperatorFirst, pos, size)
+		case i == length-1 && isOp:
+			err = parseErr(models.ErrOperatorLast, pos, size)
 		case curr == '(' && next == ')':
-			return models.ErrEmptyBrackets
-		case curr == ')' && next == '(':
-			return models.ErrMergedBrackets
-		case (curr == '*' || curr == '+' || curr == '-' || curr == '/') && (next == '*' || next == '+' || next == '-' || next == '/'):
-			return models.ErrMergedOperators
-		case curr < '(' || curr > '9':
-			return models.ErrWrongCharacter
-		case len <= 2:
-			return models.ErrInvalidExpression
-		case curr == '/' && next == '0':
-			return models.ErrDivisionByZero
+			err = parseErr(models.ErrEmptyBrackets, pos, 2)
+		case curr == ')' && next == '(' && !implicit:
+			err = parseErr(models.ErrMergedBrackets, pos, 2)
+		// после оператора может идти только унарный знак или отрицание
+		case isOp && binaryOnly(nextOp):
+			err = parseErr(models.ErrMergedOperators, nextPos, len(nextOp))
+		case curr == '(' && binaryOnly(nextOp):
+			err = parseErr(models.ErrOperatorFirst, nextPos, len(nextOp))
+		case op == "" && (curr < '(' || curr > '9') && !isName(curr):
+			_, width := utf8.DecodeRuneInString(expression[i:])
+			err = parseErr(models.ErrWrongCharacter, pos, width)
+			i += width - 1 // не проверяем остальные байты символа
+		}
+
+		operand = isName(curr) || curr == '.' || curr == ')' || (op == "!" && !isOp)
+
+		if err != nil {
+			errs = append(errs, err)
+			if !all {
+				return errs
+			}
 		}
 	}
 
 	// базовая проверка на корректность скобок
-	if start > end {
-		return models.ErrNotClosedBracket
-	} else if end > start {
-		return models.ErrNotOpenedBracket
+	if !all {
+		if start > end {
+			return append(errs, parseErr(models.ErrNotClosedBracket, opened[len(opened)-1], 1))
+		} else if end > start {
+			return append(errs, parseErr(models.ErrNotOpenedBracket, unopened[0], 1))
+		}
+	} else {
+		for _, pos := range unopened {
+			errs = append(errs, parseErr(models.ErrNotOpenedBracket, pos, 1))
+		}
+		for _, pos := range opened {
+			errs = append(errs, parseErr(models.ErrNotClosedBracket, pos, 1))
+		}
 	}
 
 	if !flag {
-		return models.ErrNoOperators
+		return append(errs, parseErr(models.ErrNoOperators, 0, length))
 	}
-	return nil
+	return errs
 }
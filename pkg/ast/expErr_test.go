@@ -2,6 +2,7 @@ package ast
 
 import (
 	"calculator/pkg/models"
+	"errors"
 	"testing"
 )
 
@@ -11,20 +12,80 @@ func TestExpErr(t *testing.T) {
 		err        error
 	}{
 		{"2+3", nil},
-		{"2+", models.ErrInvalidExpression},
-		{"+2", models.ErrOperatorFirst},
-		{"2++3", models.ErrMergedOperators},
+		{"2+", models.ErrOperatorLast},
+		{"*2", models.ErrOperatorFirst},
+		{"2+*3", models.ErrMergedOperators},
+		{"(*2)", models.ErrOperatorFirst},
+		{"-3+5", nil},
+		{"+3+5", nil},
+		{"2*(-4)", nil},
+		{"2*-4", nil},
+		{"(-(2+3))", nil},
+		{"2^3^2", nil},
+		{"2**3", nil},
+		{"-2^-2", nil},
+		{"2^*3", models.ErrMergedOperators},
+		{"2***3", models.ErrMergedOperators},
+		{"**2", models.ErrOperatorFirst},
+		{"2+3^", models.ErrOperatorLast},
 		{"2+()", models.ErrEmptyBrackets},
 		{"2+)3", models.ErrNotOpenedBracket},
-		{"2+3a", models.ErrWrongCharacter},
-		{"2/0", models.ErrDivisionByZero},
-		{"(", models.ErrInvalidExpression},
+		{"2+3#", models.ErrWrongCharacter},
+		{"max(1,-2)", nil},
+		{"max(1,,2)", models.ErrMisplacedComma},
+		{"max(,2)", models.ErrMisplacedComma},
+		{"max(1,)", models.ErrMisplacedComma},
+		{"max(1+,2)", models.ErrMisplacedComma},
+		{"7//2", nil},
+		{"7%2", nil},
+		{"3!", nil},
+		{"3!!+1", nil},
+		{"3!==6", nil},
+		{"x!==1", nil},
+		{"(1+2)!==6", nil},
+		{"!==1", models.ErrOperatorFirst},
+		{"!3+1", nil},
+		{"(!3)", nil},
+		{"2+!3", nil},
+		{"2+!", models.ErrOperatorLast},
+		{"!*3", models.ErrMergedOperators},
+		{"1<=2", nil},
+		{"1==2&&3!=4||5>6", nil},
+		{"1<*2", models.ErrMergedOperators},
+		{"1=2", models.ErrWrongCharacter},
+		{"1&2", models.ErrWrongCharacter},
+		{"1?2:3", nil},
+		{"?1:2", models.ErrOperatorFirst},
+		{"1?2:", models.ErrOperatorLast},
+		{"1?:2", models.ErrMergedOperators},
+		{"(?1)", models.ErrOperatorFirst},
+		{"2///3", models.ErrMergedOperators},
+		{"2%*3", models.ErrMergedOperators},
+		// деление на ноль - ошибка вычисления, а не разбора: такой узел может оказаться в невыбранной ветви
+		{"2//0", nil},
+		{"2%0", nil},
+		{"2/0.0", nil},
+		{"2/0.5", nil},
+		{"1<0?1/0:5", nil},
+		{"(1", models.ErrNotClosedBracket},
+		// выражение из одного операнда: число, константа, переменная, унарный оператор
+		{"7", nil},
+		{"pi", nil},
+		{"x", nil},
+		{"x2", nil},
+		{"-5", nil},
+		{"!0", nil},
+		// без единого операнда ошибка - в отсутствии операндов, а не в последнем операторе
 		{"", models.ErrNoOperators},
+		{"(", models.ErrNoOperators},
+		{"-", models.ErrNoOperators},
+		{"---", models.ErrNoOperators},
+		{"(-)", models.ErrNoOperators},
 	}
 
 	for _, tt := range tests {
-		err := expErr(tt.expression)
-		if err != tt.err {
+		err := expErr(tt.expression, false)
+		if !errors.Is(err, tt.err) {
 			t.Errorf("expErr(%s) = %v, expected %v", tt.expression, err, tt.err)
 		}
 	}
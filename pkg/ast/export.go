@@ -0,0 +1,90 @@
+package ast
+
+// вывод дерева в текстовом виде: для отладки приоритетов и для объяснения разбора
+
+import (
+	"fmt"
+	"strings"
+
+	"calculator/pkg/models"
+)
+
+// children - листья узла в порядке аргументов
+func children(node *models.AstNode) []*models.AstNode {
+	if node.Args != nil {
+		return node.Args
+	}
+
+	var nodes []*models.AstNode
+	if node.Left != nil {
+		nodes = append(nodes, node.Left)
+	}
+	if node.Right != nil {
+		nodes = append(nodes, node.Right)
+	}
+	return nodes
+}
+
+// Nodes - число узлов дерева
+func Nodes(root *models.AstNode) int {
+	n := 1
+	for _, child := range children(root) {
+		n += Nodes(child)
+	}
+	return n
+}
+
+// Depth - глубина дерева, у дерева из одного числа глубина 1
+func Depth(root *models.AstNode) int {
+	depth := 0
+	for _, child := range children(root) {
+		depth = max(depth, Depth(child))
+	}
+	return depth + 1
+}
+
+// SExpr записывает дерево в виде (оператор аргументы...): 2+3*4 - (+ 2 (* 3 4))
+func SExpr(root *models.AstNode) string {
+	nodes := children(root)
+	if len(nodes) == 0 {
+		return root.Value
+	}
+
+	parts := make([]string, 0, len(nodes)+1)
+	parts = append(parts, root.Value)
+	for _, child := range nodes {
+		parts = append(parts, SExpr(child))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// подписи ребер условия
+var branches = []string{"cond", "then", "else"}
+
+// DOT записывает дерево на языке Graphviz: dot -Tpng tree.dot -o tree.png
+// вершины называются по id узлов, поэтому их можно сопоставить с JSON-представлением
+func DOT(root *models.AstNode) string {
+	var b strings.Builder
+	b.WriteString("digraph ast {\n")
+	b.WriteString("  node [shape=circle];\n")
+	writeDOT(&b, root)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func writeDOT(b *strings.Builder, node *models.AstNode) {
+	shape := ""
+	if node.AstType == "number" {
+		shape = ", shape=box"
+	}
+	fmt.Fprintf(b, "  n%d [label=%q%s];\n", node.ID, node.Value, shape)
+
+	for i, child := range children(node) {
+		if node.AstType == "conditional" {
+			fmt.Fprintf(b, "  n%d -> n%d [label=%q];\n", node.ID, child.ID, branches[i])
+		} else {
+			fmt.Fprintf(b, "  n%d -> n%d;\n", node.ID, child.ID)
+		}
+		writeDOT(b, child)
+	}
+}
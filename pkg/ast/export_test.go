@@ -0,0 +1,77 @@
+package ast
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expression string
+		sexpr      string
+		rpn        []string
+		nodes      int
+		depth      int
+	}{
+		{"-7.5", "(neg 7.5)", []string{"7.5", "neg"}, 2, 2},
+		{"2+3*4", "(+ 2 (* 3 4))", []string{"2", "3", "4", "*", "+"}, 5, 3},
+		{"(2+3)*4", "(* (+ 2 3) 4)", []string{"2", "3", "+", "4", "*"}, 5, 3},
+		{"2^3^2", "(^ 2 (^ 3 2))", []string{"2", "3", "2", "^", "^"}, 5, 3},
+		{"-2^2", "(neg (^ 2 2))", []string{"2", "2", "^", "neg"}, 4, 3},
+		{"2^3!", "(^ 2 (! 3))", []string{"2", "3", "!", "^"}, 4, 3},
+		{"max(1, 2*3, 4)", "(max 1 (* 2 3) 4)", []string{"1", "2", "3", "*", "4", "max"}, 6, 3},
+		{"1 < 2 ? 3 : 4", "(if (< 1 2) 3 4)", []string{"1", "2", "<", "3", "4", "?:"}, 6, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			tree, err := NewParser().Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Parse(%s) error: %v", tt.expression, err)
+			}
+			if got := SExpr(tree.Root); got != tt.sexpr {
+				t.Errorf("SExpr(%s) = %s, expected %s", tt.expression, got, tt.sexpr)
+			}
+			if !reflect.DeepEqual(tree.RPN, tt.rpn) {
+				t.Errorf("Parse(%s).RPN = %v, expected %v", tt.expression, tree.RPN, tt.rpn)
+			}
+			if got := Nodes(tree.Root); got != tt.nodes {
+				t.Errorf("Nodes(%s) = %d, expected %d", tt.expression, got, tt.nodes)
+			}
+			if got := Depth(tree.Root); got != tt.depth {
+				t.Errorf("Depth(%s) = %d, expected %d", tt.expression, got, tt.depth)
+			}
+		})
+	}
+}
+
+func TestParseError(t *testing.T) {
+	_, buildErr := Build("2 + * 3")
+	_, err := NewParser().Parse("2 + * 3")
+	if err == nil || err.Error() != buildErr.Error() {
+		t.Errorf("Parse error = %v, expected the same as Build: %v", err, buildErr)
+	}
+}
+
+func TestDOT(t *testing.T) {
+	root, err := Build("1 > 0 ? 2 : -3")
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+
+	dot := DOT(root)
+	if !strings.HasPrefix(dot, "digraph ast {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Fatalf("DOT is not a digraph:\n%s", dot)
+	}
+
+	// каждая вершина объявлена один раз, у ребер условия есть подписи
+	if n := strings.Count(dot, "[label="); n != Nodes(root)+3 {
+		t.Errorf("DOT has %d labels, expected %d nodes and 3 branch labels:\n%s", n, Nodes(root), dot)
+	}
+	for _, want := range []string{`label="if"`, `label="neg"`, `label="3", shape=box`, `[label="cond"]`, `[label="then"]`, `[label="else"]`} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("DOT has no %s:\n%s", want, dot)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package ast
+
+// разбор числовых литералов: 42, 3.14, .5, 1e-9, 6.02E23, 0x1F, 0b1010, 1_000_000
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"calculator/pkg/decimal"
+	"calculator/pkg/models"
+)
+
+func digit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func hexDigit(c byte) bool {
+	return digit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func binDigit(c byte) bool {
+	return c == '0' || c == '1'
+}
+
+// начинается ли с позиции i числовой литерал
+func numberStart(str string, i int) bool {
+	return digit(str[i]) || (str[i] == '.' && i+1 < len(str) && digit(str[i+1]))
+}
+
+// lexNumber читает литерал, начинающийся с позиции i, и возвращает его
+// десятичную запись и позицию за ним
+// у неправильного литерала позиция указывает за весь ошибочный фрагмент
+func lexNumber(str string, i int) (string, int, error) {
+	start := i
+
+	if str[i] == '0' && i+1 < len(str) {
+		switch str[i+1] {
+		case 'x', 'X':
+			return lexInteger(str, start, i+2, hexDigit, 16)
+		case 'b', 'B':
+			return lexInteger(str, start, i+2, binDigit, 2)
+		}
+	}
+
+	// целая или дробная часть может отсутствовать, но не обе сразу: 5., .5
+	i, ok := digits(str, i, digit)
+	if i < len(str) && str[i] == '.' {
+		var frac bool
+		i, frac = digits(str, i+1, digit)
+		ok = ok || frac
+	}
+
+	// экспонента: e, знак и хотя бы одна цифра, иначе e - это имя (константа e)
+	if i < len(str) && (str[i] == 'e' || str[i] == 'E') {
+		j := i + 1
+		if j < len(str) && (str[j] == '+' || str[j] == '-') {
+			j++
+		}
+		if j < len(str) && digit(str[j]) {
+			var exp bool
+			i, exp = digits(str, j, digit)
+			ok = ok && exp
+		}
+	}
+
+	// вторая точка или разделитель без цифр после него: 1.2.3, 1__0, 1_
+	if i < len(str) && (str[i] == '.' || str[i] == '_') {
+		ok = false
+	}
+	if !ok {
+		end := malformedEnd(str, i)
+		return "", end, parseErr(models.ErrMalformedNumber, start, end-start)
+	}
+
+	// диапазон зависит от режима чисел и проверяется отдельно, в outOfRange
+	return strings.ReplaceAll(str[start:i], "_", ""), i, nil
+}
+
+// lexInteger читает шестнадцатеричный или двоичный литерал с префиксом
+func lexInteger(str string, start, i int, isDigit func(byte) bool, base int) (string, int, error) {
+	i, ok := digits(str, i, isDigit)
+
+	// после литерала не может сразу идти имя или цифра: 0x1G, 0b102
+	if !ok || (i < len(str) && (isName(str[i]) || str[i] == '.')) {
+		end := malformedEnd(str, i)
+		return "", end, parseErr(models.ErrMalformedNumber, start, end-start)
+	}
+
+	value, ok := new(big.Int).SetString(strings.ReplaceAll(str[start+2:i], "_", ""), base)
+	if !ok {
+		return "", i, parseErr(models.ErrMalformedNumber, start, i-start)
+	}
+	return value.String(), i, nil
+}
+
+// digits читает цифры с разделителями "_" между ними
+// возвращает false, если цифр нет или разделитель стоит не между цифрами
+func digits(str string, i int, isDigit func(byte) bool) (int, bool) {
+	start := i
+	for i < len(str) && (isDigit(str[i]) || str[i] == '_') {
+		if str[i] == '_' && (i == start || str[i-1] == '_' || i+1 >= len(str) || !isDigit(str[i+1])) {
+			return i, false
+		}
+		i++
+	}
+	return i, i > start
+}
+
+// outOfRange проверяет, что литералы помещаются в числа режима: во float64 - в его диапазон,
+// в точных режимах - в ограничение размера pkg/decimal; 1e400 допустим только в точных режимах
+func outOfRange(tokens []*token, exact bool) []error {
+	var errs []error
+	for _, tok := range tokens {
+		if tok.t != models.Operand {
+			continue
+		}
+
+		// неправильный литерал уже получил ошибку в лексере
+		fits := true
+		if exact {
+			x, err := decimal.Parse(tok.val)
+			fits = err != nil || decimal.Fits(x)
+		} else if _, err := strconv.ParseFloat(tok.val, 64); errors.Is(err, strconv.ErrRange) {
+			fits = false
+		}
+		if !fits {
+			errs = append(errs, parseErr(models.ErrMalformedNumber, tok.pos, tok.size))
+		}
+	}
+	return errs
+}
+
+// конец ошибочного литерала - все, что могло бы быть его продолжением
+func malformedEnd(str string, i int) int {
+	for i < len(str) && (isName(str[i]) || str[i] == '.') {
+		i++
+	}
+	return i
+}
@@ -34,13 +34,46 @@ func rpn(tokens []*token) ([]*token, error) {
 
 	for _, tok := range tokens {
 		switch tok.t {
-		case models.Operand:
+		case models.Operand, models.Identifier:
 			output = append(output, tok)
 
+		case models.Function:
+			tok.args = 1
+			stack.push(tok)
+
+		case models.Comma:
+			// извлекаем операторы текущего аргумента до скобки вызова
+			for stack.len() > 0 && stack.peek().t != models.OpenBracket {
+				popped, _ := stack.pop()
+				if popped.val == "?" {
+					return nil, parseErr(models.ErrUnbalancedTernary, popped.pos, popped.size)
+				}
+				output = append(output, popped)
+			}
+			if stack.len() < 2 || stack[stack.len()-2].t != models.Function {
+				return nil, parseErr(models.ErrMisplacedComma, tok.pos, tok.size)
+			}
+			stack[stack.len()-2].args++
+
 		case models.Operator:
+			// двоеточие закрывает ближайший "?": извлекаем все до него,
+			// а сам "?" становится тернарным оператором и ждет третий операнд
+			if tok.val == ":" {
+				for top := stack.peek(); top != nil && top.t != models.OpenBracket && top.val != "?"; top = stack.peek() {
+					popped, _ := stack.pop()
+					output = append(output, popped)
+				}
+				top := stack.peek()
+				if top == nil || top.val != "?" {
+					return nil, parseErr(models.ErrUnbalancedTernary, tok.pos, tok.size)
+				}
+				top.val = models.Ternary
+				break
+			}
+
 			currPriority, err := priority(tok.val)
 			if err != nil {
-				return nil, err
+				return nil, parseErr(err, tok.pos, tok.size)
 			}
 
 			// извлекаем операторы с большим или равным приоритетом
@@ -52,10 +85,11 @@ func rpn(tokens []*token) ([]*token, error) {
 
 				topPriority, err := priority(top.val)
 				if err != nil {
-					return nil, err
+					return nil, parseErr(err, top.pos, top.size)
 				}
 
-				if topPriority >= currPriority {
+				// правоассоциативный оператор не вытесняет оператор с тем же приоритетом
+				if topPriority > currPriority || (topPriority == currPriority && !rightAssoc(tok.val)) {
 					popped, _ := stack.pop()
 					output = append(output, popped)
 				} else {
@@ -64,6 +98,14 @@ func rpn(tokens []*token) ([]*token, error) {
 			}
 			stack.push(tok)
 
+		case models.Postfix:
+			// постфиксный оператор связывает сильнее всех, его операнд уже в выходе
+			output = append(output, tok)
+
+		case models.UnaryOperator:
+			// префиксный оператор ничего не извлекает из стека, его операнд еще впереди
+			stack.push(tok)
+
 		case models.OpenBracket:
 			stack.push(tok)
 
@@ -73,20 +115,29 @@ func rpn(tokens []*token) ([]*token, error) {
 			for stack.len() > 0 {
 				popped, err := stack.pop()
 				if err != nil {
-					return nil, models.ErrInvalidExpression
+					return nil, parseErr(models.ErrInvalidExpression, tok.pos, tok.size)
 				}
 				if popped.t == models.OpenBracket {
 					found = true
 					break
 				}
+				if popped.val == "?" {
+					return nil, parseErr(models.ErrUnbalancedTernary, popped.pos, popped.size)
+				}
 				output = append(output, popped)
 			}
 			if !found {
-				return nil, models.ErrNotOpenedBracket
+				return nil, parseErr(models.ErrNotOpenedBracket, tok.pos, tok.size)
+			}
+
+			// скобка закрывает вызов функции
+			if top := stack.peek(); top != nil && top.t == models.Function {
+				popped, _ := stack.pop()
+				output = append(output, popped)
 			}
 
 		default:
-			return nil, models.ErrUnknownOperator
+			return nil, parseErr(models.ErrUnknownOperator, tok.pos, tok.size)
 		}
 	}
 
@@ -97,7 +148,10 @@ func rpn(tokens []*token) ([]*token, error) {
 			return nil, err
 		}
 		if popped.t == models.OpenBracket {
-			return nil, models.ErrNotClosedBracket
+			return nil, parseErr(models.ErrNotClosedBracket, popped.pos, popped.size)
+		}
+		if popped.val == "?" {
+			return nil, parseErr(models.ErrUnbalancedTernary, popped.pos, popped.size)
 		}
 		output = append(output, popped)
 	}
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"calculator/pkg/models"
+	"errors"
 	"testing"
 )
 
@@ -24,11 +25,95 @@ func TestRpn(t *testing.T) {
 			},
 			err: nil,
 		},
+		{
+			// -3*2 -> 3 neg 2 *
+			tokens: []*token{
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operand, val: "3"},
+				{t: models.Operator, val: "*"},
+				{t: models.Operand, val: "2"},
+			},
+			expected: []*token{
+				{t: models.Operand, val: "3"},
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "*"},
+			},
+			err: nil,
+		},
+		{
+			// 2*-3 -> 2 3 neg *
+			tokens: []*token{
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "*"},
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operand, val: "3"},
+			},
+			expected: []*token{
+				{t: models.Operand, val: "2"},
+				{t: models.Operand, val: "3"},
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operator, val: "*"},
+			},
+			err: nil,
+		},
+		{
+			// 2^3^2 -> 2 3 2 ^ ^
+			tokens: []*token{
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "^"},
+				{t: models.Operand, val: "3"},
+				{t: models.Operator, val: "^"},
+				{t: models.Operand, val: "2"},
+			},
+			expected: []*token{
+				{t: models.Operand, val: "2"},
+				{t: models.Operand, val: "3"},
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "^"},
+				{t: models.Operator, val: "^"},
+			},
+			err: nil,
+		},
+		{
+			// -2^2 -> 2 2 ^ neg
+			tokens: []*token{
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "^"},
+				{t: models.Operand, val: "2"},
+			},
+			expected: []*token{
+				{t: models.Operand, val: "2"},
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "^"},
+				{t: models.UnaryOperator, val: models.Negation},
+			},
+			err: nil,
+		},
+		{
+			// 8/2/2 -> 8 2 / 2 /
+			tokens: []*token{
+				{t: models.Operand, val: "8"},
+				{t: models.Operator, val: "/"},
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "/"},
+				{t: models.Operand, val: "2"},
+			},
+			expected: []*token{
+				{t: models.Operand, val: "8"},
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "/"},
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "/"},
+			},
+			err: nil,
+		},
 	}
 
 	for _, tt := range tests {
 		result, err := rpn(tt.tokens)
-		if err != tt.err {
+		if !errors.Is(err, tt.err) {
 			t.Errorf("rpn() error = %v, expected %v", err, tt.err)
 		}
 		if len(result) != len(tt.expected) {
@@ -1,52 +1,106 @@
 package ast
 
 import (
+	"calculator/pkg/functions"
 	"calculator/pkg/models"
-	"log"
-	"regexp"
 )
 
 // структура для первоначального разбиения строки на токены
 type token struct {
-	t   string // тип токена
-	val string // значение токена
+	t    string // тип токена
+	val  string // значение токена
+	args int    // число аргументов, только для функций
+	pos  int    // смещение токена в выражении
+	size int    // длина токена в выражении
 }
 
-// работает на регулярках, проверяет, является символ оператором
-func typeCheck(symbol string) bool {
-	pattern := "[+\\-*/]"
-	r, err := regexp.Compile(pattern)
-	if err != nil {
-		log.Fatalf("./pkg/ast (func: typeCheck); regexp error occured: %s", err)
+// унарным считается знак в начале выражения, после оператора, открывающей скобки или запятой
+func unary(tokens []*token) bool {
+	if len(tokens) == 0 {
+		return true
 	}
 
-	return r.MatchString(string(symbol))
+	prev := tokens[len(tokens)-1].t
+	return prev == models.Operator || prev == models.UnaryOperator || prev == models.OpenBracket || prev == models.Comma
 }
 
-func tokens(str string) []*token {
+func letter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+}
+
+func tokens(str string) ([]*token, error) {
+	tokens, errs := lex(str)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return tokens, nil
+}
+
+// lex разбивает строку на токены и собирает ошибки в числовых литералах
+// неправильный литерал все равно становится операндом, чтобы не порождать лишних ошибок дальше
+func lex(str string) ([]*token, []error) {
+	var errs []error
 	tokens := make([]*token, 0)
 
 	i := 0
 	for i < len(str) {
 		switch {
-		case typeCheck(string(str[i])): // если оператор
-			tokens = append(tokens, &token{t: models.Operator, val: string(str[i])})
+		case (str[i] == '-' || str[i] == '+') && unary(tokens): // если унарный знак
+			// унарный плюс ничего не меняет, поэтому в токены не попадает
+			if str[i] == '-' {
+				tokens = append(tokens, &token{t: models.UnaryOperator, val: models.Negation, pos: i, size: 1})
+			}
 			i++
 
-		case str[i] >= 48 && str[i] <= 57: // если число
-			tmp := ""
-			for i < len(str) && ((str[i] >= 48 && str[i] <= 57) || str[i] == 44 || str[i] == 46) {
-				tmp += string(str[i])
-				i++
+		case operatorAfter(str, i, !unary(tokens)) == "!": // ! после операнда - факториал, иначе - отрицание
+			if unary(tokens) {
+				tokens = append(tokens, &token{t: models.UnaryOperator, val: models.Not, pos: i, size: 1})
+			} else {
+				tokens = append(tokens, &token{t: models.Postfix, val: "!", pos: i, size: 1})
+			}
+			i++
+
+		case operatorAt(str, i) != "": // если оператор
+			op := operatorAt(str, i)
+			val := op
+			if op == "**" { // ** - синоним ^
+				val = "^"
 			}
-			tokens = append(tokens, &token{t: models.Operand, val: string(tmp)})
+			tokens = append(tokens, &token{t: models.Operator, val: val, pos: i, size: len(op)})
+			i += len(op)
+
+		case numberStart(str, i): // если число
+			start := i
+			val, end, err := lexNumber(str, i)
+			if err != nil {
+				errs = append(errs, err)
+				val = str[start:end]
+			}
+			i = end
+			tokens = append(tokens, &token{t: models.Operand, val: val, pos: start, size: i - start})
 
 		case str[i] == 40 || str[i] == 41: // если скобка
 			tp := models.OpenBracket
 			if str[i] == 41 {
 				tp = models.CloseBracket
 			}
-			tokens = append(tokens, &token{t: tp, val: string(str[i])})
+			tokens = append(tokens, &token{t: tp, val: string(str[i]), pos: i, size: 1})
+			i++
+
+		case letter(str[i]): // если имя: функция, если за ним идет скобка
+			start := i
+			for i < len(str) && (letter(str[i]) || (str[i] >= 48 && str[i] <= 57)) {
+				i++
+			}
+
+			tp := models.Identifier
+			if i < len(str) && str[i] == '(' {
+				tp = models.Function
+			}
+			tokens = append(tokens, &token{t: tp, val: str[start:i], pos: start, size: i - start})
+
+		case str[i] == ',': // разделитель аргументов функции
+			tokens = append(tokens, &token{t: models.Comma, val: ",", pos: i, size: 1})
 			i++
 
 		default:
@@ -54,5 +108,66 @@ func tokens(str string) []*token {
 		}
 	}
 
-	return tokens
+	return tokens, errs
+}
+
+// два операнда подряд без оператора между ними: "2(3)", "(1)(2)", "2sqrt(4)"
+func adjacent(prev, tok *token) bool {
+	if prev == nil {
+		return false
+	}
+
+	endsOperand := prev.t == models.Operand || prev.t == models.Identifier || prev.t == models.CloseBracket || prev.t == models.Postfix
+	startsOperand := tok.t == models.Operand || tok.t == models.Identifier || tok.t == models.Function || tok.t == models.OpenBracket
+	return endsOperand && startsOperand
+}
+
+// implicitMultiplication вставляет пропущенный знак умножения между операндами: 2(3+4), (1+2)(3+4), 3pi
+// имя перед скобкой, которое не является функцией, но имеет значение, считается множителем: pi(1+2)
+func implicitMultiplication(tokens []*token, vars map[string]float64) []*token {
+	result := make([]*token, 0, len(tokens))
+	var prev *token
+	for _, tok := range tokens {
+		if tok.t == models.Function && bound(tok.val, vars) {
+			if _, ok := functions.Lookup(tok.val); !ok {
+				tok.t = models.Identifier
+			}
+		}
+
+		if adjacent(prev, tok) {
+			result = append(result, &token{t: models.Operator, val: "*", pos: tok.pos})
+		}
+		result = append(result, tok)
+		prev = tok
+	}
+	return result
+}
+
+// exponentMark - имя e или E, которое может быть только началом экспоненты числа перед ним
+func exponentMark(tok *token) bool {
+	return tok.t == models.Identifier && (tok.val == "e" || tok.val == "E")
+}
+
+// missingOperator ищет место, где между операндами пропущен оператор
+func missingOperator(tokens []*token) error {
+	if errs := missingOperators(tokens); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+func missingOperators(tokens []*token) []error {
+	var errs []error
+	for i := 1; i < len(tokens); i++ {
+		if !adjacent(tokens[i-1], tokens[i]) {
+			continue
+		}
+		// 1e, 1.5e-x: экспонента без цифр, а не число, за которым идет константа e
+		if prev := tokens[i-1]; prev.t == models.Operand && exponentMark(tokens[i]) && prev.pos+prev.size == tokens[i].pos {
+			errs = append(errs, parseErr(models.ErrMalformedNumber, prev.pos, prev.size+tokens[i].size))
+			continue
+		}
+		errs = append(errs, parseErr(models.ErrInvalidExpression, tokens[i].pos, tokens[i].size))
+	}
+	return errs
 }
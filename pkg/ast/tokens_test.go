@@ -30,10 +30,60 @@ func TestTokens(t *testing.T) {
 				{t: models.CloseBracket, val: ")"},
 			},
 		},
+		{
+			input: "-3+5",
+			expected: []*token{
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operand, val: "3"},
+				{t: models.Operator, val: "+"},
+				{t: models.Operand, val: "5"},
+			},
+		},
+		{
+			input: "2*(-4)-+1",
+			expected: []*token{
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "*"},
+				{t: models.OpenBracket, val: "("},
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operand, val: "4"},
+				{t: models.CloseBracket, val: ")"},
+				{t: models.Operator, val: "-"},
+				{t: models.Operand, val: "1"},
+			},
+		},
+		{
+			input: "2**3^2",
+			expected: []*token{
+				{t: models.Operand, val: "2"},
+				{t: models.Operator, val: "^"},
+				{t: models.Operand, val: "3"},
+				{t: models.Operator, val: "^"},
+				{t: models.Operand, val: "2"},
+			},
+		},
+		{
+			input: "max(-1,log10(x2))",
+			expected: []*token{
+				{t: models.Function, val: "max"},
+				{t: models.OpenBracket, val: "("},
+				{t: models.UnaryOperator, val: models.Negation},
+				{t: models.Operand, val: "1"},
+				{t: models.Comma, val: ","},
+				{t: models.Function, val: "log10"},
+				{t: models.OpenBracket, val: "("},
+				{t: models.Identifier, val: "x2"},
+				{t: models.CloseBracket, val: ")"},
+				{t: models.CloseBracket, val: ")"},
+			},
+		},
 	}
 
 	for _, tt := range tests {
-		result := tokens(tt.input)
+		result, err := tokens(tt.input)
+		if err != nil {
+			t.Fatalf("tokens(%s) error: %v", tt.input, err)
+		}
 		if len(result) != len(tt.expected) {
 			t.Errorf("tokens(%s) = %v, expected %v", tt.input, result, tt.expected)
 		}
@@ -44,3 +94,38 @@ func TestTokens(t *testing.T) {
 		}
 	}
 }
+
+func TestLexNumber(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		end      int
+	}{
+		{"42", "42", 2},
+		{"3.14+1", "3.14", 4},
+		{".5", ".5", 2},
+		{"5.", "5.", 2},
+		{"1e-9", "1e-9", 4},
+		{"6.02E23", "6.02E23", 7},
+		{"2e+3*4", "2e+3", 4},
+		{"2e", "2", 1}, // e без цифр - константа
+		{"2e-", "2", 1},
+		{"0x1F", "31", 4},
+		{"0XfF", "255", 4},
+		{"0b1010", "10", 6},
+		{"0b1_0", "2", 5},
+		{"1_000_000", "1000000", 9},
+		{"1_000.000_1", "1000.0001", 11},
+	}
+
+	for _, tt := range tests {
+		val, end, err := lexNumber(tt.input, 0)
+		if err != nil {
+			t.Errorf("lexNumber(%s) error: %v", tt.input, err)
+			continue
+		}
+		if val != tt.expected || end != tt.end {
+			t.Errorf("lexNumber(%s) = %q, %d, expected %q, %d", tt.input, val, end, tt.expected, tt.end)
+		}
+	}
+}
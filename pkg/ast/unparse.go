@@ -0,0 +1,233 @@
+package ast
+
+// обратное преобразование: дерево в строку с наименьшим числом скобок
+// разбор результата Unparse дает то же дерево (отрицательные числа из переменных становятся унарным минусом)
+
+import (
+	"strings"
+
+	"calculator/pkg/models"
+)
+
+// приоритет числа, вызова функции и выражения в скобках: их никогда не нужно оборачивать
+const atom = 11
+
+// Unparse записывает дерево в каноническом виде: 2 + 3 * 4, (2 + 3) * 4, -2^2, (-2)^2
+func Unparse(root *models.AstNode) string {
+	s, _ := printer{}.print(root)
+	return s
+}
+
+// LaTeX записывает дерево в виде формулы LaTeX: деление - \frac, степень - верхний индекс, условие - cases
+func LaTeX(root *models.AstNode) string {
+	s, _ := printer{latex: true}.print(root)
+	return s
+}
+
+type printer struct {
+	latex bool
+}
+
+// операторы в записи LaTeX, остальные записываются как есть
+var latexOperators = map[string]string{
+	"*":             `\cdot`,
+	"%":             `\bmod`,
+	"<=":            `\le`,
+	">=":            `\ge`,
+	"==":            "=",
+	"!=":            `\ne`,
+	"&&":            `\land`,
+	"||":            `\lor`,
+	models.Negation: "-",
+	models.Not:      `\neg `,
+}
+
+// функции с собственной записью в LaTeX, остальные - \operatorname
+var latexFunctions = map[string]string{
+	"sin":   `\sin`,
+	"cos":   `\cos`,
+	"tan":   `\tan`,
+	"ln":    `\ln`,
+	"exp":   `\exp`,
+	"log10": `\log_{10}`,
+	"min":   `\min`,
+	"max":   `\max`,
+}
+
+// print возвращает запись узла и ее приоритет: родитель оборачивает запись в скобки,
+// если она связывает слабее, чем нужно на ее месте
+func (p printer) print(node *models.AstNode) (string, int) {
+	switch node.AstType {
+	case "number":
+		// отрицательное число из переменной читается как унарный минус
+		if strings.HasPrefix(node.Value, "-") {
+			prio, _ := priority(models.Negation)
+			return node.Value, prio
+		}
+		if p.latex && strings.ContainsAny(node.Value, "eE") {
+			return p.scientific(node.Value)
+		}
+		return node.Value, atom
+	case "variable":
+		return p.name(node.Value), atom
+	case "function":
+		return p.call(node), atom
+	case "conditional":
+		return p.conditional(node)
+	}
+
+	prio, _ := priority(node.Value)
+	if node.Right == nil {
+		return p.unary(node, prio), prio
+	}
+
+	left, lp := p.print(node.Left)
+	right, rp := p.print(node.Right)
+
+	if p.latex {
+		switch node.Value {
+		case "/":
+			return `\frac{` + left + `}{` + right + `}`, atom
+		case "//":
+			return `\left\lfloor\frac{` + left + `}{` + right + `}\right\rfloor`, atom
+		case "^":
+			// показатель в фигурных скобках, основание - в круглых, если это не число или вызов
+			if lp < atom || node.Left.AstType == "operation" {
+				left = p.wrap(left)
+			}
+			return left + `^{` + right + `}`, prio
+		}
+	}
+
+	// равный приоритет оборачивается со стороны, противоположной ассоциативности: (2^3)^2, 2 - (3 - 4)
+	if lp < prio || (lp == prio && rightAssoc(node.Value)) {
+		left = p.wrap(left)
+	}
+	// префиксный оператор справа ограничен слева сам: 2^-3, 2 * -3
+	if !prefix(node.Right) && (rp < prio || (rp == prio && !rightAssoc(node.Value))) {
+		right = p.wrap(right)
+	}
+
+	if node.Value == "^" {
+		return left + "^" + right, prio
+	}
+	return left + " " + p.operator(node.Value) + " " + right, prio
+}
+
+// unary записывает префиксные -x, !x и постфиксный x!
+func (p printer) unary(node *models.AstNode, prio int) string {
+	operand, op := p.print(node.Left)
+
+	if node.Value == "!" {
+		if op < prio {
+			operand = p.wrap(operand)
+		}
+		return operand + "!"
+	}
+
+	if op < prio {
+		operand = p.wrap(operand)
+	}
+	return p.operator(node.Value) + operand
+}
+
+// conditional записывает условие как cond ? a : b
+// оборачивать нужно только условие: ?: правоассоциативен, а ветвь между ? и : ограничена ими самими
+func (p printer) conditional(node *models.AstNode) (string, int) {
+	prio, _ := priority(models.Ternary)
+	cond, cp := p.print(node.Args[0])
+	a, _ := p.print(node.Args[1])
+	b, _ := p.print(node.Args[2])
+
+	if p.latex {
+		// cases связывает слабее любого оператора: (c ? a : b)^2 и c ? a : b + 1 оборачиваются
+		return `\begin{cases} ` + a + ` & \text{if } ` + cond + ` \\ ` + b + ` & \text{otherwise} \end{cases}`, prio
+	}
+
+	if cp <= prio {
+		cond = p.wrap(cond)
+	}
+	return cond + " ? " + a + " : " + b, prio
+}
+
+// scientific записывает число с показателем как произведение: 1e3 - 1\times10^{3}
+func (p printer) scientific(value string) (string, int) {
+	mantissa, exponent, _ := strings.Cut(strings.ToLower(value), "e")
+	exponent = strings.TrimPrefix(exponent, "+")
+
+	prio, _ := priority("*")
+	return mantissa + `\times10^{` + exponent + `}`, prio
+}
+
+// name записывает имя переменной или константы; в LaTeX многобуквенные имена - прямым шрифтом
+func (p printer) name(name string) string {
+	if !p.latex {
+		return name
+	}
+	switch {
+	case name == "pi":
+		return `\pi`
+	case len(name) > 1:
+		return `\mathrm{` + strings.ReplaceAll(name, "_", `\_`) + `}`
+	}
+	return name
+}
+
+func (p printer) call(node *models.AstNode) string {
+	args := make([]string, len(node.Args))
+	for i, arg := range node.Args {
+		args[i], _ = p.print(arg)
+	}
+	list := strings.Join(args, ", ")
+
+	if !p.latex {
+		return node.Value + "(" + list + ")"
+	}
+
+	switch node.Value {
+	case "sqrt":
+		return `\sqrt{` + list + `}`
+	case "abs":
+		return `\left|` + list + `\right|`
+	case "floor":
+		return `\left\lfloor ` + list + ` \right\rfloor`
+	case "ceil":
+		return `\left\lceil ` + list + ` \right\rceil`
+	}
+
+	name, ok := latexFunctions[node.Value]
+	if !ok {
+		name = `\operatorname{` + node.Value + `}`
+	}
+	return name + p.wrap(list)
+}
+
+func (p printer) operator(op string) string {
+	if p.latex {
+		if s, ok := latexOperators[op]; ok {
+			return s
+		}
+	}
+	switch op {
+	case models.Negation:
+		return "-"
+	case models.Not:
+		return "!"
+	}
+	return op
+}
+
+func (p printer) wrap(s string) string {
+	if p.latex {
+		return `\left(` + s + `\right)`
+	}
+	return "(" + s + ")"
+}
+
+// prefix - начинается ли запись узла с префиксного оператора
+func prefix(node *models.AstNode) bool {
+	if node.AstType == "number" {
+		return strings.HasPrefix(node.Value, "-")
+	}
+	return node.AstType == "operation" && (node.Value == models.Negation || node.Value == models.Not)
+}
@@ -0,0 +1,191 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+
+	"calculator/pkg/models"
+)
+
+// clearIDs обнуляет id, чтобы сравнивать только форму деревьев
+func clearIDs(node *models.AstNode) {
+	node.ID = 0
+	for _, child := range children(node) {
+		clearIDs(child)
+	}
+}
+
+func TestUnparse(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"2+3*4", "2 + 3 * 4"},
+		{"(2+3)*4", "(2 + 3) * 4"},
+		{"((2))*(((3)))", "2 * 3"},
+		{"2-(3-4)", "2 - (3 - 4)"},
+		{"(2-3)-4", "2 - 3 - 4"},
+		{"2/(3*4)", "2 / (3 * 4)"},
+		{"2^3^2", "2^3^2"},
+		{"(2^3)^2", "(2^3)^2"},
+		{"2**-1", "2^-1"},
+		{"-2^2", "-2^2"},
+		{"(-2)^2", "(-2)^2"},
+		{"-(2+3)", "-(2 + 3)"},
+		{"2*(-3)", "2 * -3"},
+		{"2-(-3)", "2 - -3"},
+		{"(-3)!", "(-3)!"},
+		{"-(3!)", "-3!"},
+		{"2^(3!)", "2^3!"},
+		{"(2^3)!", "(2^3)!"},
+		{"(3!)==6", "3! == 6"},
+		{"3!!=6", "3! != 6"},
+		{"!(1&&0)||1", "!(1 && 0) || 1"},
+		{"(1||0)&&1", "(1 || 0) && 1"},
+		{"1<2==(3<4)", "1 < 2 == 3 < 4"},
+		{"max(1,(2+3),-4)", "max(1, 2 + 3, -4)"},
+		{"if(1>0, 2, 3)", "1 > 0 ? 2 : 3"},
+		{"(1?2:3)?4:5", "(1 ? 2 : 3) ? 4 : 5"},
+		{"1?2:(3?4:5)", "1 ? 2 : 3 ? 4 : 5"},
+		{"(1?2:3)+1", "(1 ? 2 : 3) + 1"},
+		{"7//2%3", "7 // 2 % 3"},
+		{"7//(2%3)", "7 // (2 % 3)"},
+		{"0x1F+1_000", "31 + 1000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			root, err := Build(tt.expression)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.expression, err)
+			}
+			if got := Unparse(root); got != tt.expected {
+				t.Errorf("Unparse(%s) = %s, expected %s", tt.expression, got, tt.expected)
+			}
+		})
+	}
+}
+
+// запись Unparse разбирается в то же дерево
+func TestUnparseRoundTrip(t *testing.T) {
+	expressions := []string{
+		"2+3*4-5/6", "2-(3-(4-5))", "2^-3^2", "-2^-2", "(2^-3)^2", "-(-2)", "!!1", "2!!",
+		"(-(2+3))!", "-(2^3)!", "1!=!0", "1<!0", "1+(3!)==(7-1)", "3!==6", "(1+3!)==7", "1<2<3", "1<(2<3)",
+		"1&&(0||1)", "(1&&0)||1", "!(1<2)", "1?2?3:4:5", "(1?2:3)*(4?5:6)", "2*(1?2:3)",
+		"max(1?2:3, -4, 5!)", "round(-2.5, 0)^2", "sqrt(2)^2!", "1e-9*2", "1e+20-1",
+		"-(1?2:3)", "!(1?0:1)", "2^(1?2:3)", "(2//3)//4", "2//(3//4)", "-2%(-3)",
+	}
+
+	for _, expression := range expressions {
+		t.Run(expression, func(t *testing.T) {
+			root, err := Build(expression)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", expression, err)
+			}
+			s := Unparse(root)
+			again, err := Build(s)
+			if err != nil {
+				t.Fatalf("Build(Unparse(%s) = %s) error: %v", expression, s, err)
+			}
+
+			clearIDs(root)
+			clearIDs(again)
+			if !reflect.DeepEqual(root, again) {
+				t.Errorf("Unparse(%s) = %s parses to %s, expected %s", expression, s, SExpr(again), SExpr(root))
+			}
+		})
+	}
+}
+
+// отрицательное значение переменной записывается так же, как унарный минус
+func TestUnparseNegativeVariable(t *testing.T) {
+	root, err := BuildWithVariables("x^2+y!", map[string]float64{"x": -2, "y": -1.5})
+	if err != nil {
+		t.Fatalf("Build error: %v", err)
+	}
+	if got, expected := Unparse(root), "(-2)^2 + (-1.5)!"; got != expected {
+		t.Errorf("Unparse = %s, expected %s", got, expected)
+	}
+}
+
+// запись выражения сохраняет имена переменных и констант, а не их значения
+func TestUnparseSymbolic(t *testing.T) {
+	tests := []struct {
+		expression string
+		syntax     Syntax
+		normalized string
+		latex      string
+	}{
+		{"x^2+y!", "", "x^2 + y!", `x^{2} + y!`},
+		{"rate*(1+x_1)", "", "rate * (1 + x_1)", `\mathrm{rate} \cdot \left(1 + \mathrm{x\_1}\right)`},
+		{"sin(pi/6)+e", "", "sin(pi / 6) + e", `\sin\left(\frac{\pi}{6}\right) + e`},
+		{"2x(x+1)", SyntaxMath, "2 * x * (x + 1)", `2 \cdot x \cdot \left(x + 1\right)`},
+	}
+	vars := map[string]float64{"x": -2, "y": -1.5, "rate": 1e20, "x_1": 3}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			p := &Parser{Variables: vars, Syntax: tt.syntax}
+			tree, err := p.Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Parse(%s) error: %v", tt.expression, err)
+			}
+			if got := Unparse(tree.Symbolic); got != tt.normalized {
+				t.Errorf("Unparse(%s) = %s, expected %s", tt.expression, got, tt.normalized)
+			}
+			if got := LaTeX(tree.Symbolic); got != tt.latex {
+				t.Errorf("LaTeX(%s) = %s, expected %s", tt.expression, got, tt.latex)
+			}
+
+			// запись разбирается с теми же переменными в то же дерево
+			again, err := p.Build(Unparse(tree.Symbolic))
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", Unparse(tree.Symbolic), err)
+			}
+			clearIDs(again)
+			clearIDs(tree.Root)
+			if !reflect.DeepEqual(again, tree.Root) {
+				t.Errorf("Build(Unparse(%s)) = %s, expected %s", tt.expression, Unparse(again), Unparse(tree.Root))
+			}
+		})
+	}
+}
+
+func TestLaTeX(t *testing.T) {
+	tests := []struct {
+		expression string
+		expected   string
+	}{
+		{"2+3*4", `2 + 3 \cdot 4`},
+		{"(1+2)/(3-4)", `\frac{1 + 2}{3 - 4}`},
+		{"(1+2)*3", `\left(1 + 2\right) \cdot 3`},
+		{"7//2", `\left\lfloor\frac{7}{2}\right\rfloor`},
+		{"2^(3+1)", `2^{3 + 1}`},
+		{"(1/2)^2", `\left(\frac{1}{2}\right)^{2}`},
+		{"(-2)^2", `\left(-2\right)^{2}`},
+		{"sqrt(2)+abs(-3)", `\sqrt{2} + \left|-3\right|`},
+		{"sin(pi/6)*log10(100)", `\sin\left(\frac{3.141592653589793}{6}\right) \cdot \log_{10}\left(100\right)`},
+		{"round(2.5, 1)+max(1, 2)", `\operatorname{round}\left(2.5, 1\right) + \max\left(1, 2\right)`},
+		{"1<=2&&!(3!=4)", `1 \le 2 \land \neg \left(3 \ne 4\right)`},
+		{"7%3 == 1", `7 \bmod 3 = 1`},
+		{"1>0 ? 2 : 3", `\begin{cases} 2 & \text{if } 1 > 0 \\ 3 & \text{otherwise} \end{cases}`},
+		// cases в операнде оборачивается
+		{"(1>0 ? 2 : 3)^2", `\left(\begin{cases} 2 & \text{if } 1 > 0 \\ 3 & \text{otherwise} \end{cases}\right)^{2}`},
+		{"1+(1>0 ? 2 : 3)*2", `1 + \left(\begin{cases} 2 & \text{if } 1 > 0 \\ 3 & \text{otherwise} \end{cases}\right) \cdot 2`},
+		{"1e3+2.5E-7", `1\times10^{3} + 2.5\times10^{-7}`},
+		{"2^1e+3", `2^{1\times10^{3}}`},
+		{"1e3^2", `\left(1\times10^{3}\right)^{2}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			root, err := Build(tt.expression)
+			if err != nil {
+				t.Fatalf("Build(%s) error: %v", tt.expression, err)
+			}
+			if got := LaTeX(root); got != tt.expected {
+				t.Errorf("LaTeX(%s) = %s, expected %s", tt.expression, got, tt.expected)
+			}
+		})
+	}
+}
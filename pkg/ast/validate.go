@@ -0,0 +1,122 @@
+package ast
+
+// проверка выражения без вычисления: собирает все ошибки за один проход
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"calculator/pkg/functions"
+	"calculator/pkg/models"
+)
+
+// Validate возвращает все найденные в выражении ошибки с позициями в исходной строке
+// пустой результат означает, что выражение можно отправлять на вычисление
+func (p *Parser) Validate(expression string) []*models.ParseError {
+	stripped, offsets := strip(expression)
+
+	errs := expErrs(stripped, true, p.implicit())
+	tokens, lexErrs := lex(stripped)
+	errs = append(errs, lexErrs...)
+	errs = append(errs, outOfRange(tokens, p.Exact)...)
+	if p.implicit() {
+		tokens = implicitMultiplication(tokens, p.Variables)
+	}
+	errs = append(errs, missingOperators(tokens)...)
+	errs = append(errs, bindErrs(tokens, p.Variables)...)
+	errs = append(errs, callErrs(tokens)...)
+
+	// разбор в дерево имеет смысл, только если выражение прошло все проверки выше,
+	// иначе он лишь повторит уже найденные ошибки
+	if len(errs) == 0 {
+		rpn, err := rpn(tokens)
+		if err == nil {
+			_, err = new(builder).ast(rpn)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return diagnostics(errs, expression, offsets)
+}
+
+func Validate(expression string, vars map[string]float64) []*models.ParseError {
+	return (&Parser{Variables: vars}).Validate(expression)
+}
+
+// callErrs проверяет имена функций и число аргументов у каждого вызова
+func callErrs(tokens []*token) []error {
+	var errs []error
+	for i, tok := range tokens {
+		if tok.t != models.Function {
+			continue
+		}
+
+		if _, ok := functions.Lookup(tok.val); !ok && tok.val != models.Conditional {
+			errs = append(errs, parseErr(fmt.Errorf("%w: %s", models.ErrUnknownFunction, tok.val), tok.pos, tok.size))
+			continue
+		}
+
+		args, closed := countArgs(tokens[i+1:])
+		if !closed {
+			continue // о незакрытой скобке уже сообщила expErrs
+		}
+		if err := checkCall(tok.val, args); err != nil {
+			errs = append(errs, parseErr(err, tok.pos, tok.size))
+		}
+	}
+	return errs
+}
+
+// countArgs считает аргументы вызова по запятым верхнего уровня внутри скобок
+func countArgs(tokens []*token) (int, bool) {
+	depth := 0
+	args := 1
+	for _, tok := range tokens {
+		switch tok.t {
+		case models.OpenBracket:
+			depth++
+		case models.CloseBracket:
+			depth--
+			if depth == 0 {
+				return args, true
+			}
+		case models.Comma:
+			if depth == 1 {
+				args++
+			}
+		}
+	}
+	return args, false
+}
+
+// diagnostics переводит ошибки в исходные координаты, убирает повторы и сортирует по позиции
+func diagnostics(errs []error, expression string, offsets []int) []*models.ParseError {
+	type key struct {
+		code string
+		pos  int
+	}
+
+	seen := make(map[key]bool)
+	result := make([]*models.ParseError, 0, len(errs))
+	for _, err := range errs {
+		var pe *models.ParseError
+		if !errors.As(locate(err, expression, offsets), &pe) {
+			continue
+		}
+
+		k := key{pe.Code(), pe.Position}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		result = append(result, pe)
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Position < result[j].Position
+	})
+	return result
+}
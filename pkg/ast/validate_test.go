@@ -0,0 +1,68 @@
+package ast
+
+import (
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	type diag struct {
+		code     string
+		position int
+		token    string
+	}
+
+	tests := []struct {
+		expression string
+		vars       map[string]float64
+		expected   []diag
+	}{
+		{"2+2*2", nil, nil},
+		{"rate*2", map[string]float64{"rate": 0.5}, nil},
+		{
+			expression: "(2+*3)) + foo(1) + sqrt(1, 2) + x + #1",
+			expected: []diag{
+				{"merged_operators", 3, "*"},
+				{"not_opened_bracket", 6, ")"},
+				{"unknown_function", 10, "foo"},
+				{"arguments_count", 19, "sqrt"},
+				{"unbound_variable", 32, "x"},
+				{"wrong_character", 36, "#"},
+			},
+		},
+		{
+			expression: "((1+2)",
+			expected: []diag{
+				{"not_closed_bracket", 0, "("},
+			},
+		},
+		{
+			expression: "2(3) + 4 sqrt(5)",
+			expected: []diag{
+				{"invalid_expression", 1, "("},
+				{"invalid_expression", 9, "sqrt"},
+			},
+		},
+		{
+			// структурные ошибки находит только разбор в дерево
+			expression: "max(1,2)+sqrt",
+			expected: []diag{
+				{"unbound_variable", 9, "sqrt"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			result := Validate(tt.expression, tt.vars)
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Validate(%s) = %v, expected %v", tt.expression, result, tt.expected)
+			}
+			for i, pe := range result {
+				got := diag{pe.Code(), pe.Position, pe.Token}
+				if got != tt.expected[i] {
+					t.Errorf("Validate(%s)[%d] = %v, expected %v", tt.expression, i, got, tt.expected[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package ast
+
+import (
+	"math"
+	"strconv"
+
+	"calculator/pkg/models"
+)
+
+// встроенные константы
+var constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// bound - есть ли у имени значение
+func bound(name string, vars map[string]float64) bool {
+	if _, ok := vars[name]; ok {
+		return true
+	}
+	_, ok := constants[name]
+	return ok
+}
+
+// bind подставляет вместо имен значения переменных запроса и констант
+// переменные запроса перекрывают константы с тем же именем
+func bind(tokens []*token, vars map[string]float64) error {
+	if errs := bindErrs(tokens, vars); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// bindErrs подставляет все известные имена и возвращает ошибки для остальных
+func bindErrs(tokens []*token, vars map[string]float64) []error {
+	var errs []error
+	for _, tok := range tokens {
+		if tok.t != models.Identifier {
+			continue
+		}
+
+		value, ok := vars[tok.val]
+		if !ok {
+			value, ok = constants[tok.val]
+		}
+		if !ok {
+			errs = append(errs, parseErr(&models.UnboundVariableError{Name: tok.val}, tok.pos, tok.size))
+			continue
+		}
+
+		tok.t = models.Operand
+		tok.val = strconv.FormatFloat(value, 'g', -1, 64)
+	}
+
+	return errs
+}
@@ -1,207 +1,246 @@
 package calculator
 
-// import (
-// 	"calculator/internal/service"
-// 	"calculator/pkg/config"
-// 	"calculator/pkg/models"
-// 	"errors"
-// 	"strconv"
-// 	"unicode"
-// )
-
-// type tokenType int
-
-// const (
-// 	tokenNumber tokenType = iota
-// 	tokenOperator
-// 	tokenLParen
-// 	tokenRParen
-// )
-
-// type token struct {
-// 	typ tokenType
-// 	val string
-// }
-
-// type Calculator struct {
-// 	taskService *service.TaskService
-// }
-
-// func New(taskService *service.TaskService) *Calculator {
-// 	return &Calculator{
-// 		taskService: taskService,
-// 	}
-// }
-
-// func (c *Calculator) Calculate(expr string) (float64, error) {
-// 	tokens, err := tokenize(expr)
-// 	if err != nil {
-// 		return 0, err
-// 	}
-
-// 	rpn, err := shuntingYard(tokens)
-// 	if err != nil {
-// 		return 0, err
-// 	}
-
-// 	return c.evalRPN(rpn)
-// }
-
-// func tokenize(expr string) ([]token, error) {
-// 	var tokens []token
-// 	i := 0
-// 	for i < len(expr) {
-// 		ch := expr[i]
-// 		if ch == ' ' {
-// 			i++
-// 			continue
-// 		}
-
-// 		if unicode.IsDigit(rune(ch)) || ch == '.' {
-// 			start := i
-// 			dotCount := 0
-// 			for i < len(expr) && (unicode.IsDigit(rune(expr[i])) || expr[i] == '.') {
-// 				if expr[i] == '.' {
-// 					dotCount++
-// 					if dotCount > 1 {
-// 						return nil, errors.New("invalid number format")
-// 					}
-// 				}
-// 				i++
-// 			}
-// 			tokens = append(tokens, token{typ: tokenNumber, val: expr[start:i]})
-// 		} else if ch == '+' || ch == '-' || ch == '*' || ch == '/' {
-// 			tokens = append(tokens, token{typ: tokenOperator, val: string(ch)})
-// 			i++
-// 		} else if ch == '(' {
-// 			tokens = append(tokens, token{typ: tokenLParen, val: string(ch)})
-// 			i++
-// 		} else if ch == ')' {
-// 			tokens = append(tokens, token{typ: tokenRParen, val: string(ch)})
-// 			i++
-// 		} else {
-// 			return nil, errors.New("invalid character: " + string(ch))
-// 		}
-// 	}
-// 	return tokens, nil
-// }
-
-// func precedence(op string) int {
-// 	switch op {
-// 	case "+", "-":
-// 		return 1
-// 	case "*", "/":
-// 		return 2
-// 	}
-// 	return 0
-// }
-
-// func shuntingYard(tokens []token) ([]token, error) {
-// 	var output []token
-// 	var stack []token
-
-// 	for _, tok := range tokens {
-// 		switch tok.typ {
-// 		case tokenNumber:
-// 			output = append(output, tok)
-// 		case tokenOperator:
-// 			for len(stack) > 0 {
-// 				top := stack[len(stack)-1]
-// 				if top.typ == tokenOperator && precedence(top.val) >= precedence(tok.val) {
-// 					output = append(output, top)
-// 					stack = stack[:len(stack)-1]
-// 				} else {
-// 					break
-// 				}
-// 			}
-// 			stack = append(stack, tok)
-// 		case tokenLParen:
-// 			stack = append(stack, tok)
-// 		case tokenRParen:
-// 			foundLParen := false
-// 			for len(stack) > 0 {
-// 				top := stack[len(stack)-1]
-// 				stack = stack[:len(stack)-1]
-// 				if top.typ == tokenLParen {
-// 					foundLParen = true
-// 					break
-// 				} else {
-// 					output = append(output, top)
-// 				}
-// 			}
-// 			if !foundLParen {
-// 				return nil, errors.New("bracket mismatch")
-// 			}
-// 		}
-// 	}
-
-// 	for len(stack) > 0 {
-// 		top := stack[len(stack)-1]
-// 		stack = stack[:len(stack)-1]
-// 		if top.typ == tokenLParen || top.typ == tokenRParen {
-// 			return nil, errors.New("bracket mismatch")
-// 		}
-// 		output = append(output, top)
-// 	}
-
-// 	return output, nil
-// }
-
-// func (c *Calculator) evalRPN(tokens []token) (float64, error) {
-// 	var stack []*models.Future
-
-// 	for _, tok := range tokens {
-// 		switch tok.typ {
-// 		case tokenNumber:
-// 			num, err := strconv.ParseFloat(tok.val, 64)
-// 			if err != nil {
-// 				return 0, err
-// 			}
-// 			future := models.NewFuture()
-// 			future.SetResult(num)
-// 			stack = append(stack, future)
-// 		case tokenOperator:
-// 			if len(stack) < 2 {
-// 				return 0, errors.New("invalid expression")
-// 			}
-
-// 			b := stack[len(stack)-1]
-// 			a := stack[len(stack)-2]
-// 			stack = stack[:len(stack)-2]
-
-// 			future := models.NewFuture()
-// 			stack = append(stack, future)
-
-// 			task := models.Task{
-// 				Arg1:      a.Get(),
-// 				Arg2:      b.Get(),
-// 				Operation: tok.val,
-// 			}
-
-// 			// Create task and wait for result
-// 			createdTask := c.taskService.CreateTask(task.Arg1, task.Arg2, task.Operation, getOperationTime(tok.val))
-// 			c.taskService.SetResult(createdTask.ID, future.Get())
-// 		}
-// 	}
-
-// 	if len(stack) != 1 {
-// 		return 0, errors.New("invalid expression")
-// 	}
-
-// 	return stack[0].Get(), nil
-// }
-
-// func getOperationTime(op string) int {
-// 	switch op {
-// 	case "+":
-// 		return config.Configuration.AddTimeMs
-// 	case "-":
-// 		return config.Configuration.SubtractTimeMs
-// 	case "*":
-// 		return config.Configuration.MultiplyTimeMs
-// 	case "/":
-// 		return config.Configuration.DivideTimeMs
-// 	default:
-// 		return 0
-// 	}
-// }
+// локальный вычислитель: считает дерево из ast.Build прямо в процессе, без gRPC и агентов
+// семантика и ошибки те же, что у распределенного вычисления: операторы общие с агентом,
+// условия, && и || ленивые, в точных режимах значения округляются после каждой операции
+
+import (
+	"fmt"
+	"strconv"
+
+	"calculator/pkg/ast"
+	"calculator/pkg/decimal"
+	"calculator/pkg/functions"
+	"calculator/pkg/models"
+)
+
+// Result - результат выражения
+type Result struct {
+	Value float64 // в точных режимах - приближение точного результата
+	Exact string  // точный результат в режимах decimal и rational, в режиме float пустой
+}
+
+type options struct {
+	variables map[string]float64
+	syntax    ast.Syntax
+	precision models.Precision
+	err       error
+}
+
+// Option - параметр вычисления
+type Option func(*options)
+
+// WithVariables задает значения переменных, они перекрывают константы с тем же именем
+func WithVariables(vars map[string]float64) Option {
+	return func(o *options) {
+		o.variables = vars
+	}
+}
+
+// WithSyntax задает синтаксис выражения, ast.SyntaxMath разрешает пропускать знак умножения
+func WithSyntax(syntax ast.Syntax) Option {
+	return func(o *options) {
+		o.syntax = syntax
+	}
+}
+
+// WithDecimal включает точную десятичную арифметику: scale знаков после запятой, пустой rounding - half_even
+func WithDecimal(scale int, rounding decimal.Rounding) Option {
+	return func(o *options) {
+		ctx, err := decimal.NewContext(scale, string(rounding))
+		if err != nil {
+			o.err = err
+			return
+		}
+		o.precision = models.Precision{Mode: models.ModeDecimal, Scale: ctx.Scale, Rounding: string(ctx.Rounding)}
+	}
+}
+
+// WithRational включает точную арифметику в обыкновенных дробях
+func WithRational() Option {
+	return func(o *options) {
+		o.precision = models.Precision{Mode: models.ModeRational}
+	}
+}
+
+// WithPrecision задает режим чисел так же, как поля запроса к API
+func WithPrecision(p models.Precision) Option {
+	switch p.Mode {
+	case "", models.ModeFloat:
+		return func(o *options) {
+			o.precision = models.Precision{Mode: models.ModeFloat}
+		}
+	case models.ModeDecimal:
+		return WithDecimal(p.Scale, decimal.Rounding(p.Rounding))
+	case models.ModeRational:
+		return WithRational()
+	default:
+		return func(o *options) {
+			o.err = fmt.Errorf("unknown number mode: %s", p.Mode)
+		}
+	}
+}
+
+// Evaluate разбирает и считает выражение
+// ошибки разбора - те же *models.ParseError и *models.UnboundVariableError, что у API
+func Evaluate(expression string, opts ...Option) (Result, error) {
+	o, err := apply(opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	exact := o.precision.Mode == models.ModeDecimal || o.precision.Mode == models.ModeRational
+	parser := &ast.Parser{Variables: o.variables, Syntax: o.syntax, Exact: exact}
+	root, err := parser.Build(expression)
+	if err != nil {
+		return Result{}, err
+	}
+	return evaluate(root, o.precision)
+}
+
+// EvaluateTree считает уже построенное дерево, само дерево не меняется
+// WithVariables и WithSyntax здесь не действуют: они нужны только при разборе
+func EvaluateTree(root *models.AstNode, opts ...Option) (Result, error) {
+	o, err := apply(opts)
+	if err != nil {
+		return Result{}, err
+	}
+	return evaluate(root, o.precision)
+}
+
+// Fold считает поддерево и возвращает значение в той записи, в которой его вернул бы агент:
+// так оптимизатор может заменить поддерево числом, не меняя результата выражения
+func Fold(node *models.AstNode, precision models.Precision) (string, error) {
+	ev := evaluator{precision: precision, ctx: decimal.FromPrecision(precision)}
+	return ev.eval(node)
+}
+
+func apply(opts []Option) (options, error) {
+	o := options{precision: models.Precision{Mode: models.ModeFloat}}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o, o.err
+}
+
+func evaluate(root *models.AstNode, precision models.Precision) (Result, error) {
+	ev := evaluator{precision: precision, ctx: decimal.FromPrecision(precision)}
+	value, err := ev.eval(root)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !ev.exact() {
+		v, err := strconv.ParseFloat(value, 64)
+		return Result{Value: v}, err
+	}
+
+	// литерал или выбранная ветвь условия записаны как в выражении: 1e-9, 0.125 при scale 2
+	x, err := decimal.Parse(value)
+	if err != nil {
+		return Result{}, err
+	}
+	exact := ev.ctx.Format(x)
+	return Result{Value: decimal.Approx(exact), Exact: exact}, nil
+}
+
+// evaluator считает узлы так же, как оркестратор с агентами:
+// значения узлов - строки, во float64 они записываются без потери точности
+type evaluator struct {
+	precision models.Precision
+	ctx       decimal.Context
+}
+
+func (ev evaluator) exact() bool {
+	return ev.precision.Mode == models.ModeDecimal || ev.precision.Mode == models.ModeRational
+}
+
+func (ev evaluator) eval(node *models.AstNode) (string, error) {
+	switch {
+	case node.AstType == "number":
+		return node.Value, nil
+
+	// невыбранная ветвь условия не считается вовсе
+	case node.AstType == "conditional":
+		cond, err := ev.eval(node.Args[0])
+		if err != nil {
+			return "", err
+		}
+		if Truthy(cond) {
+			return ev.eval(node.Args[1])
+		}
+		return ev.eval(node.Args[2])
+
+	case node.AstType == "function":
+		args := make([]string, len(node.Args))
+		for i, arg := range node.Args {
+			v, err := ev.eval(arg)
+			if err != nil {
+				return "", err
+			}
+			args[i] = v
+		}
+		return ev.call(node.Value, args)
+	}
+
+	a, err := ev.eval(node.Left)
+	if err != nil {
+		return "", err
+	}
+
+	// левый операнд уже решает результат: 0 && x = 0, 1 || x = 1
+	if (node.Value == "&&" || node.Value == "||") && Truthy(a) == (node.Value == "||") {
+		if node.Value == "||" {
+			return "1", nil
+		}
+		return "0", nil
+	}
+
+	b := ""
+	if node.Right != nil {
+		if b, err = ev.eval(node.Right); err != nil {
+			return "", err
+		}
+	}
+	return ev.operate(node.Value, a, b)
+}
+
+func (ev evaluator) operate(operator, a, b string) (string, error) {
+	if ev.exact() {
+		return ev.ctx.Calculate(operator, a, b)
+	}
+
+	x, err := operand(a)
+	if err != nil {
+		return "", err
+	}
+	y, err := operand(b)
+	if err != nil {
+		return "", err
+	}
+	result, err := Apply(operator, x, y)
+	if err != nil {
+		return "", err
+	}
+	return format(result), nil
+}
+
+func (ev evaluator) call(name string, args []string) (string, error) {
+	if ev.exact() {
+		return ev.ctx.Call(name, args)
+	}
+
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		v, err := operand(arg)
+		if err != nil {
+			return "", err
+		}
+		values[i] = v
+	}
+	result, err := functions.Call(name, values)
+	if err != nil {
+		return "", err
+	}
+	return format(result), nil
+}
@@ -1,39 +1,161 @@
 package calculator
 
-// import (
-// 	"calculator/internal/service"
-// 	"testing"
-// )
-
-// func TestCalculator(t *testing.T) {
-// 	tests := []struct {
-// 		name     string
-// 		expr     string
-// 		expected float64
-// 		wantErr  bool
-// 	}{
-// 		{"simple addition", "2 + 2", 4, false},
-// 		{"simple subtraction", "5 - 3", 2, false},
-// 		{"simple multiplication", "3 * 4", 12, false},
-// 		{"simple division", "8 / 2", 4, false},
-// 		{"complex expression", "3 + 4 * 2 / (1 - 5)", 1, false},
-// 		{"division by zero", "5 / 0", 0, true},
-// 		{"invalid character", "2 # 3", 0, true},
-// 		{"invalid brackets", "(2 + 3", 0, true},
-// 	}
-
-// 	calc := New(service.NewTaskService())
-
-// 	for _, tt := range tests {
-// 		t.Run(tt.name, func(t *testing.T) {
-// 			result, err := calc.Calculate(tt.expr)
-// 			if (err != nil) != tt.wantErr {
-// 				t.Errorf("Calculate() error = %v, wantErr %v", err, tt.wantErr)
-// 				return
-// 			}
-// 			if !tt.wantErr && result != tt.expected {
-// 				t.Errorf("Calculate() = %v, want %v", result, tt.expected)
-// 			}
-// 		})
-// 	}
-// }
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"calculator/pkg/ast"
+	"calculator/pkg/decimal"
+	"calculator/pkg/models"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		opts     []Option
+		expected float64
+		wantErr  bool
+	}{
+		{"simple addition", "2 + 2", nil, 4, false},
+		{"precedence", "3 + 4 * 2 / (1 - 5)", nil, 1, false},
+		{"power", "2^3^2", nil, 512, false},
+		{"unary minus", "-2^2", nil, -4, false},
+		{"functions", "sqrt(16)+max(1,2*3,-4)", nil, 10, false},
+		{"integer operators", "7//2+7%4-3!", nil, 0, false},
+		{"comparisons", "!(2>=3)&&1!=2", nil, 1, false},
+		{"factorial before ==", "3! == 6", nil, 1, false},
+		{"variable factorial before ==", "x!==1", []Option{WithVariables(map[string]float64{"x": 1})}, 1, false},
+		{"conditional", "if(5<3, 10, 20)+1", nil, 21, false},
+		{"dead branch", "1>2?1/(1-1):5", nil, 5, false},
+		{"short circuit", "0&&sqrt(-1)", nil, 0, false},
+		{"literal zero in dead branch", "1<0?1/0:5", nil, 5, false},
+		{"literal zero in dead if", "if(0,1/0,2)", nil, 2, false},
+		{"literal zero after short circuit", "0&&1/0", nil, 0, false},
+		{"large values", "1e20+1", nil, 1e20, false},
+		{"constant alone", "pi", nil, 3.141592653589793, false},
+		{"variable alone", "x", []Option{WithVariables(map[string]float64{"x": 3})}, 3, false},
+		{"negative number alone", "-5", nil, -5, false},
+		{"number alone", "7", nil, 7, false},
+		{"not alone", "!0", nil, 1, false},
+		{"implicit product alone", "2x", []Option{WithVariables(map[string]float64{"x": 3}), WithSyntax(ast.SyntaxMath)}, 6, false},
+		{"small values", "0.1+0.2-0.3", nil, 5.551115123125783e-17, false},
+		{"variables", "rate*principal", []Option{WithVariables(map[string]float64{"rate": 0.05, "principal": 1000})}, 50, false},
+		{"math syntax", "2pi(r+1)", []Option{WithVariables(map[string]float64{"r": 3}), WithSyntax(ast.SyntaxMath)}, 8 * 3.141592653589793, false},
+		{"division by zero", "5 / (1-1)", nil, 0, true},
+		{"domain error", "sqrt(1-2)", nil, 0, true},
+		{"factorial out of range", "(170+1)!", nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Evaluate(tt.expr, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate(%s) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+			}
+			if !tt.wantErr && result.Value != tt.expected {
+				t.Errorf("Evaluate(%s) = %v, expected %v", tt.expr, result.Value, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expr     string
+		opts     []Option
+		expected string
+		target   error
+	}{
+		{"1/(2-2)", nil, "division by zero", nil},
+		{"1/0+1", nil, "division by zero", nil},
+		{"1>0?1/0:5", nil, "division by zero", nil},
+		{"sqrt(-1+0)", nil, "argument is out of the function domain: sqrt: argument must be non-negative, got -1", models.ErrDomain},
+		{"1e308*10", nil, "* result is out of range", nil},
+		{"1e308+1e308", nil, "+ result is out of range", nil},
+		{"-1e308-1e308", nil, "- result is out of range", nil},
+		{"1e308/1e-10", nil, "/ result is out of range", nil},
+		{"1e308//1e-10", nil, "// result is out of range", nil},
+		{"10^400", nil, "power result is out of range", nil},
+		{"2.5!", nil, "factorial is defined only for non-negative integers, got 2.5", nil},
+		{"2+*3", nil, "two operators are next to each other at position 2", models.ErrMergedOperators},
+		{"x+1", nil, "unbound variable: x at position 0", models.ErrUnboundVariable},
+		{"2^0.5+1", []Option{WithDecimal(10, "")}, "non-integer powers are not supported in decimal mode", nil},
+		{"((10^10000)^10000)^10000", []Option{WithRational()}, "power result is out of range", nil},
+		{"10000!*10000!*10000!*10000!*10000!*10000!*10000!*10000!*10000!", []Option{WithRational()}, "* result is out of range", nil},
+		{"sqrt(2)+1", []Option{WithRational()}, "sqrt: result is irrational, got 2", nil},
+		{"1+1", []Option{WithDecimal(-1, "")}, "scale must be between 0 and 1000", decimal.ErrScale},
+		{"1+1", []Option{WithDecimal(2, "nearest")}, "unknown rounding mode: nearest", decimal.ErrUnknownRounding},
+		{"1+1", []Option{WithPrecision(models.Precision{Mode: "complex"})}, "unknown number mode: complex", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Evaluate(tt.expr, tt.opts...)
+			if err == nil || err.Error() != tt.expected {
+				t.Fatalf("Evaluate(%s) error = %v, expected %q", tt.expr, err, tt.expected)
+			}
+			if tt.target != nil && !errors.Is(err, tt.target) {
+				t.Errorf("Evaluate(%s) error = %v, expected to wrap %v", tt.expr, err, tt.target)
+			}
+		})
+	}
+
+	var pe *models.ParseError
+	if _, err := Evaluate("(1+2"); !errors.As(err, &pe) || pe.Position != 0 {
+		t.Errorf("Evaluate((1+2) error = %v, expected *models.ParseError at position 0", err)
+	}
+}
+
+func TestEvaluateExact(t *testing.T) {
+	tests := []struct {
+		expr     string
+		opts     []Option
+		expected Result
+	}{
+		{"0.1+0.2", []Option{WithDecimal(decimal.DefaultScale, "")}, Result{Value: 0.3, Exact: "0.3"}},
+		{"2/3", []Option{WithDecimal(2, decimal.Down)}, Result{Value: 0.66, Exact: "0.66"}},
+		{"1/3*3", []Option{WithDecimal(5, "")}, Result{Value: 0.99999, Exact: "0.99999"}},
+		{"1/3+1/6", []Option{WithRational()}, Result{Value: 0.5, Exact: "1/2"}},
+		{"1>0 ? 0.25 : 1", []Option{WithRational()}, Result{Value: 0.25, Exact: "1/4"}},
+		{"1/3-1/3 || 0.5", []Option{WithRational()}, Result{Value: 1, Exact: "1"}},
+		{"2/3", []Option{WithPrecision(models.Precision{Mode: models.ModeDecimal, Scale: 3, Rounding: "half_up"})}, Result{Value: 0.667, Exact: "0.667"}},
+		{"2/3", []Option{WithPrecision(models.Precision{Mode: models.ModeRational})}, Result{Value: 2.0 / 3, Exact: "2/3"}},
+		{"1e-9", []Option{WithDecimal(decimal.DefaultScale, "")}, Result{Value: 1e-9, Exact: "0.000000001"}},
+		{"1e400/1e399", []Option{WithRational()}, Result{Value: 10, Exact: "10"}},
+		{"0.125", []Option{WithDecimal(2, "")}, Result{Value: 0.12, Exact: "0.12"}},
+		{"1>0 ? 0.125 : 1", []Option{WithDecimal(2, decimal.HalfUp)}, Result{Value: 0.13, Exact: "0.13"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			result, err := Evaluate(tt.expr, tt.opts...)
+			if err != nil {
+				t.Fatalf("Evaluate(%s) error: %v", tt.expr, err)
+			}
+			if result != tt.expected {
+				t.Errorf("Evaluate(%s) = %+v, expected %+v", tt.expr, result, tt.expected)
+			}
+		})
+	}
+}
+
+// дерево можно посчитать несколько раз: вычислитель его не меняет
+func TestEvaluateTree(t *testing.T) {
+	root, err := ast.Build("(1+2)*if(3>2, 4, 5)")
+	if err != nil {
+		t.Fatalf("ast.Build error: %v", err)
+	}
+	before, _ := ast.Build("(1+2)*if(3>2, 4, 5)")
+
+	for range 2 {
+		result, err := EvaluateTree(root)
+		if err != nil || result.Value != 12 {
+			t.Fatalf("EvaluateTree = %v, %v; expected 12", result.Value, err)
+		}
+	}
+	if !reflect.DeepEqual(root, before) {
+		t.Error("EvaluateTree changed the tree")
+	}
+}
@@ -0,0 +1,144 @@
+package calculator
+
+// операторы в режиме float; их использует и агент, и локальный вычислитель,
+// поэтому результаты и ошибки в обоих случаях совпадают
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"calculator/pkg/decimal"
+	"calculator/pkg/models"
+)
+
+// Apply применяет оператор к аргументам, у унарных операторов b не используется
+func Apply(operator string, a, b float64) (float64, error) {
+	switch operator {
+	case models.Negation:
+		return -a, nil
+	case "^":
+		return finite("power", math.Pow(a, b))
+	case "*":
+		return finite("*", a*b)
+	case "/":
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return finite("/", a/b)
+	case "//":
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return finite("//", math.Floor(a/b))
+	case "%":
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return modulo(a, b), nil
+	case "!":
+		return factorial(a)
+	case "<", "<=", ">", ">=", "==", "!=", "&&", "||", models.Not:
+		return logic(a, b, operator), nil
+	case "+":
+		return finite("+", a+b)
+	case "-":
+		return finite("-", a-b)
+	default:
+		return 0, fmt.Errorf("unknown operator %s", operator)
+	}
+}
+
+// Truthy - истинность значения узла: истинно любое ненулевое значение
+// в точных режимах значения бывают дробями и числами вне диапазона float64
+func Truthy(value string) bool {
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return v != 0
+	}
+	v, err := decimal.Parse(value)
+	return err == nil && v.Sign() != 0
+}
+
+// finite отклоняет результат вне float64, сообщение как у decimal: "* result is out of range"
+func finite(what string, result float64) (float64, error) {
+	if math.IsNaN(result) {
+		return 0, fmt.Errorf("%s result is undefined", what)
+	}
+	if math.IsInf(result, 0) {
+		return 0, fmt.Errorf("%s result is out of range", what)
+	}
+	return result, nil
+}
+
+// остаток берется со знаком делителя, чтобы a == b*(a//b) + a%b
+func modulo(a, b float64) float64 {
+	result := math.Mod(a, b)
+	if result != 0 && (result < 0) != (b < 0) {
+		result += b
+	}
+	return result
+}
+
+func factorial(n float64) (float64, error) {
+	if n < 0 || n != math.Trunc(n) {
+		return 0, fmt.Errorf("factorial is defined only for non-negative integers, got %g", n)
+	}
+
+	result := 1.0
+	for i := 2.0; i <= n; i++ {
+		result *= i
+		if math.IsInf(result, 0) {
+			return 0, errors.New("factorial result is out of range")
+		}
+	}
+	return result, nil
+}
+
+// сравнения и логические операторы возвращают 1 или 0, истинно любое ненулевое значение
+func logic(a, b float64, operator string) float64 {
+	var result bool
+	switch operator {
+	case "<":
+		result = a < b
+	case "<=":
+		result = a <= b
+	case ">":
+		result = a > b
+	case ">=":
+		result = a >= b
+	case "==":
+		result = a == b
+	case "!=":
+		result = a != b
+	case "&&":
+		result = a != 0 && b != 0
+	case "||":
+		result = a != 0 || b != 0
+	case models.Not:
+		result = a == 0
+	}
+
+	if result {
+		return 1
+	}
+	return 0
+}
+
+// operand разбирает значение узла; пустой второй аргумент бывает у унарных операторов
+func operand(s string) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid operand %q", s)
+	}
+	return value, nil
+}
+
+// format - кратчайшая запись, которая читается обратно в то же float64, как у оркестратора
+func format(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
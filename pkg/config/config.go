@@ -10,7 +10,22 @@ type Config struct {
 	SubtractTimeMs      int
 	MultiplyTimeMs      int
 	DivideTimeMs        int
+	PowerTimeMs         int
+	ModuloTimeMs        int
+	FloorDivideTimeMs   int
+	FactorialTimeMs     int
+	LogicTimeMs         int
+	FunctionTimeMs      int
 	AgentComputingPower int
+	OptimizeFold        string // какие константы оркестратор сворачивает сам: none, cheap, all
+	OptimizeIdentities  bool
+	OptimizeDedupe      bool
+	CacheSize           int    // записей в кэше результатов в памяти, 0 - без кэша в памяти
+	CachePostgres       bool   // хранить кэш результатов еще и в Postgres
+	LeaseTimeoutMs      int    // сколько агент может держать задачу без результата
+	TaskMaxAttempts     int    // сколько раз задача отправляется агентам, прежде чем выражение получит ошибку
+	MaxTimeoutMs        int    // наибольший срок вычисления выражения, 0 - без ограничения
+	UserWeights         string // веса пользователей в планировщике: "1=4,7=2", остальные - 1
 }
 
 func Load() Config {
@@ -19,7 +34,22 @@ func Load() Config {
 		SubtractTimeMs:      int(getEnvInt("TIME_SUBTRACTION_MS", 1000)),
 		MultiplyTimeMs:      int(getEnvInt("TIME_MULTIPLICATIONS_MS", 1000)),
 		DivideTimeMs:        int(getEnvInt("TIME_DIVISIONS_MS", 1000)),
+		PowerTimeMs:         int(getEnvInt("TIME_POWER_MS", 1000)),
+		ModuloTimeMs:        int(getEnvInt("TIME_MODULO_MS", 1000)),
+		FloorDivideTimeMs:   int(getEnvInt("TIME_FLOOR_DIVISIONS_MS", 1000)),
+		FactorialTimeMs:     int(getEnvInt("TIME_FACTORIAL_MS", 1000)),
+		LogicTimeMs:         int(getEnvInt("TIME_LOGIC_MS", 1000)),
+		FunctionTimeMs:      int(getEnvInt("TIME_FUNCTIONS_MS", 1000)),
 		AgentComputingPower: getEnvInt("COMPUTING_POWER", 10),
+		OptimizeFold:        os.Getenv("OPTIMIZE_FOLD"),
+		OptimizeIdentities:  getEnvBool("OPTIMIZE_IDENTITIES", true),
+		OptimizeDedupe:      getEnvBool("OPTIMIZE_DEDUPE", true),
+		CacheSize:           getEnvInt("CACHE_SIZE", 10000),
+		CachePostgres:       getEnvBool("CACHE_POSTGRES", false),
+		LeaseTimeoutMs:      getEnvInt("LEASE_TIMEOUT_MS", 30000),
+		TaskMaxAttempts:     getEnvInt("TASK_MAX_ATTEMPTS", 3),
+		MaxTimeoutMs:        getEnvInt("MAX_TIMEOUT_MS", 300000),
+		UserWeights:         os.Getenv("USER_WEIGHTS"),
 	}
 }
 
@@ -33,3 +63,12 @@ func getEnvInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
@@ -0,0 +1,403 @@
+package decimal
+
+// точная арифметика для режимов "precision": "decimal" и "number_mode": "rational"
+// значения передаются строками, считаются в big.Rat; в режиме decimal
+// после каждой операции округляются до Scale знаков после запятой,
+// в режиме rational записываются несократимой дробью без округления
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"calculator/pkg/functions"
+	"calculator/pkg/models"
+)
+
+// Rounding - способ округления до Scale знаков
+type Rounding string
+
+const (
+	HalfEven Rounding = "half_even" // банковское округление
+	HalfUp   Rounding = "half_up"   // половина - от нуля
+	HalfDown Rounding = "half_down" // половина - к нулю
+	Up       Rounding = "up"        // от нуля
+	Down     Rounding = "down"      // к нулю (отбрасывание)
+	Ceiling  Rounding = "ceiling"   // к +бесконечности
+	Floor    Rounding = "floor"     // к -бесконечности
+)
+
+const (
+	DefaultScale    = 20
+	MaxScale        = 1000
+	DefaultRounding = HalfEven
+
+	maxExponent  = 10000 // ограничения, чтобы одна задача не занимала агента бесконечно
+	maxFactorial = 10000
+	maxBits      = 1 << 20 // размер числителя и знаменателя результата, около 315 тысяч цифр
+)
+
+var (
+	ErrUnknownRounding = errors.New("unknown rounding mode")
+	ErrScale           = fmt.Errorf("scale must be between 0 and %d", MaxScale)
+)
+
+// Context - параметры точного режима одного выражения
+type Context struct {
+	Scale    int
+	Rounding Rounding
+	Fraction bool // режим rational: Scale и Rounding не используются
+}
+
+// Rational - контекст режима rational
+func Rational() Context {
+	return Context{Fraction: true}
+}
+
+// FromPrecision - контекст точного режима выражения
+func FromPrecision(p models.Precision) Context {
+	if p.Mode == models.ModeRational {
+		return Rational()
+	}
+	return Context{Scale: p.Scale, Rounding: Rounding(p.Rounding)}
+}
+
+// NewContext проверяет параметры запроса, пустой rounding - DefaultRounding
+func NewContext(scale int, rounding string) (Context, error) {
+	if scale < 0 || scale > MaxScale {
+		return Context{}, ErrScale
+	}
+
+	r := Rounding(rounding)
+	switch r {
+	case "":
+		r = DefaultRounding
+	case HalfEven, HalfUp, HalfDown, Up, Down, Ceiling, Floor:
+	default:
+		return Context{}, fmt.Errorf("%w: %s", ErrUnknownRounding, rounding)
+	}
+	return Context{Scale: scale, Rounding: r}, nil
+}
+
+// Parse разбирает десятичную строку или дробь: 42, -0.1, 1e-9, 1/3
+func Parse(s string) (*big.Rat, error) {
+	x, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("invalid operand %q", s)
+	}
+	return x, nil
+}
+
+// Round округляет x до Scale знаков после запятой
+func (c Context) Round(x *big.Rat) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(c.Scale)), nil)
+	num := new(big.Int).Mul(x.Num(), scale)
+	den := x.Denom()
+
+	// QuoRem отбрасывает дробную часть, остаток имеет знак числа
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 && c.awayFromZero(q, rem, den) {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	return new(big.Rat).SetFrac(q, scale)
+}
+
+// awayFromZero решает, нужно ли увеличить модуль отброшенного результата q
+func (c Context) awayFromZero(q, rem, den *big.Int) bool {
+	// сравниваем отброшенную часть с половиной: 2|rem| ? den
+	half := new(big.Int).Abs(rem)
+	half.Lsh(half, 1)
+	cmp := half.Cmp(den)
+
+	switch c.Rounding {
+	case Up:
+		return true
+	case Down:
+		return false
+	case Ceiling:
+		return rem.Sign() > 0
+	case Floor:
+		return rem.Sign() < 0
+	case HalfUp:
+		return cmp >= 0
+	case HalfDown:
+		return cmp > 0
+	default: // HalfEven
+		return cmp > 0 || (cmp == 0 && q.Bit(0) == 1)
+	}
+}
+
+// Approx - ближайшее к значению число float64
+// значения вне диапазона float64 приближения не имеют, для них возвращается 0
+func Approx(value string) float64 {
+	x, err := Parse(value)
+	if err != nil {
+		return 0
+	}
+	f, _ := x.Float64()
+	if math.IsInf(f, 0) {
+		return 0
+	}
+	return f
+}
+
+// Format записывает x десятичной строкой без лишних нулей: 0.3, 12, -2.5
+// в режиме rational - несократимой дробью: 1/2, -7/3, 4
+func (c Context) Format(x *big.Rat) string {
+	if c.Fraction {
+		return x.RatString()
+	}
+
+	s := c.Round(x).FloatString(c.Scale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+// Calculate применяет оператор к десятичным строкам, у унарных операторов b пустой
+func (c Context) Calculate(operator, a, b string) (string, error) {
+	x, err := Parse(a)
+	if err != nil {
+		return "", err
+	}
+	y := new(big.Rat)
+	if b != "" {
+		if y, err = Parse(b); err != nil {
+			return "", err
+		}
+	}
+
+	var result *big.Rat
+	switch operator {
+	case models.Negation:
+		result = new(big.Rat).Neg(x)
+	case "+":
+		result = new(big.Rat).Add(x, y)
+	case "-":
+		result = new(big.Rat).Sub(x, y)
+	case "*":
+		result = new(big.Rat).Mul(x, y)
+	case "/":
+		if y.Sign() == 0 {
+			return "", errors.New("division by zero")
+		}
+		result = new(big.Rat).Quo(x, y)
+	case "//":
+		if y.Sign() == 0 {
+			return "", errors.New("division by zero")
+		}
+		result = new(big.Rat).SetInt(floor(new(big.Rat).Quo(x, y)))
+	case "%":
+		if y.Sign() == 0 {
+			return "", errors.New("division by zero")
+		}
+		// остаток со знаком делителя: a - b*floor(a/b)
+		q := new(big.Rat).SetInt(floor(new(big.Rat).Quo(x, y)))
+		result = new(big.Rat).Sub(x, q.Mul(q, y))
+	case "^":
+		if result, err = c.power(x, y); err != nil {
+			return "", err
+		}
+	case "!":
+		if result, err = factorial(x); err != nil {
+			return "", err
+		}
+	case "<", "<=", ">", ">=", "==", "!=", "&&", "||", models.Not:
+		result = boolRat(compare(operator, x, y))
+	default:
+		return "", fmt.Errorf("operator %s is not supported in %s mode", operator, c.mode())
+	}
+
+	// умножения больших факториалов и степеней иначе растут без ограничений от узла к узлу
+	if !Fits(result) {
+		return "", fmt.Errorf("%s result is out of range", operator)
+	}
+	return c.Format(result), nil
+}
+
+// Call вычисляет функцию; трансцендентные функции точно не считаются, поэтому не поддерживаются
+func (c Context) Call(name string, args []string) (string, error) {
+	if err := c.checkArity(name, len(args)); err != nil {
+		return "", err
+	}
+
+	values := make([]*big.Rat, len(args))
+	for i, arg := range args {
+		x, err := Parse(arg)
+		if err != nil {
+			return "", err
+		}
+		values[i] = x
+	}
+	x := values[0]
+
+	var result *big.Rat
+	switch name {
+	case "abs":
+		result = new(big.Rat).Abs(x)
+	case "floor":
+		result = new(big.Rat).SetInt(floor(x))
+	case "ceil":
+		result = new(big.Rat).SetInt(new(big.Int).Neg(floor(new(big.Rat).Neg(x))))
+	case "round":
+		// как и в обычном режиме, половина округляется от нуля
+		digits := 0
+		if len(values) == 2 {
+			if !values[1].IsInt() || !values[1].Num().IsInt64() {
+				return "", fmt.Errorf("%w: round: number of digits must be an integer, got %s", models.ErrDomain, args[1])
+			}
+			digits = int(min(max(values[1].Num().Int64(), -MaxScale), MaxScale))
+		}
+		if digits >= 0 {
+			result = Context{Scale: digits, Rounding: HalfUp}.Round(x)
+			break
+		}
+		// round(1234, -2) = 1200
+		unit := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(-digits)), nil))
+		result = Context{Rounding: HalfUp}.Round(new(big.Rat).Quo(x, unit))
+		result.Mul(result, unit)
+	case "min", "max":
+		result = x
+		for _, v := range values[1:] {
+			if (name == "min") == (v.Cmp(result) < 0) {
+				result = v
+			}
+		}
+	case "sqrt":
+		if x.Sign() < 0 {
+			return "", fmt.Errorf("%w: sqrt: argument must be non-negative, got %s", models.ErrDomain, args[0])
+		}
+		var err error
+		if result, err = c.sqrt(x); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("function %s is not supported in %s mode", name, c.mode())
+	}
+
+	return c.Format(result), nil
+}
+
+// функции, которые считаются точно; имена и число аргументов те же, что в pkg/functions
+var exact = map[string]bool{
+	"abs": true, "floor": true, "ceil": true, "round": true, "min": true, "max": true, "sqrt": true,
+}
+
+func (c Context) checkArity(name string, n int) error {
+	if err := functions.CheckArity(name, n); err != nil {
+		return err
+	}
+	if !exact[name] {
+		return fmt.Errorf("function %s is not supported in %s mode", name, c.mode())
+	}
+	return nil
+}
+
+// mode - название режима для сообщений об ошибках
+func (c Context) mode() string {
+	if c.Fraction {
+		return models.ModeRational
+	}
+	return models.ModeDecimal
+}
+
+// floor - наибольшее целое, не большее x
+// знаменатель big.Rat всегда положителен, а евклидово деление в этом случае округляет вниз
+func floor(x *big.Rat) *big.Int {
+	return new(big.Int).Div(x.Num(), x.Denom())
+}
+
+func (c Context) power(x, y *big.Rat) (*big.Rat, error) {
+	if !y.IsInt() {
+		return nil, fmt.Errorf("non-integer powers are not supported in %s mode", c.mode())
+	}
+	n := y.Num()
+	if n.CmpAbs(big.NewInt(maxExponent)) > 0 {
+		return nil, errors.New("power result is out of range")
+	}
+	if x.Sign() == 0 && n.Sign() < 0 {
+		return nil, errors.New("power result is undefined")
+	}
+
+	e := new(big.Int).Abs(n)
+	// размер результата оценивается до возведения: (10^10000)^10000 не помещается в память
+	bits := max(x.Num().BitLen(), x.Denom().BitLen())
+	if bits > 1 && int64(bits-1)*e.Int64() > maxBits {
+		return nil, errors.New("power result is out of range")
+	}
+	num := new(big.Int).Exp(x.Num(), e, nil)
+	den := new(big.Int).Exp(x.Denom(), e, nil)
+	if n.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+func factorial(x *big.Rat) (*big.Rat, error) {
+	if x.Sign() < 0 || !x.IsInt() {
+		return nil, fmt.Errorf("factorial is defined only for non-negative integers, got %s", x.RatString())
+	}
+	if x.Num().Cmp(big.NewInt(maxFactorial)) > 0 {
+		return nil, errors.New("factorial result is out of range")
+	}
+	return new(big.Rat).SetInt(new(big.Int).MulRange(1, x.Num().Int64())), nil
+}
+
+// Fits - не слишком ли велико число, чтобы передавать его дальше: так ограничены и результаты, и литералы
+func Fits(x *big.Rat) bool {
+	return x.Num().BitLen() <= maxBits && x.Denom().BitLen() <= maxBits
+}
+
+// sqrt считается в big.Float с запасом точности и округляется до Scale
+// в режиме rational корень точен, только если числитель и знаменатель - полные квадраты
+func (c Context) sqrt(x *big.Rat) (*big.Rat, error) {
+	if c.Fraction {
+		num, den := new(big.Int).Sqrt(x.Num()), new(big.Int).Sqrt(x.Denom())
+		if new(big.Int).Mul(num, num).Cmp(x.Num()) != 0 || new(big.Int).Mul(den, den).Cmp(x.Denom()) != 0 {
+			return nil, fmt.Errorf("sqrt: result is irrational, got %s", x.RatString())
+		}
+		return new(big.Rat).SetFrac(num, den), nil
+	}
+
+	prec := uint(c.Scale)*4 + 64 // ~3.33 бита на десятичный знак плюс запас
+	f := new(big.Float).SetPrec(prec).SetRat(x)
+	r, _ := f.Sqrt(f).Rat(nil)
+	return r, nil
+}
+
+func compare(operator string, x, y *big.Rat) bool {
+	switch operator {
+	case "<":
+		return x.Cmp(y) < 0
+	case "<=":
+		return x.Cmp(y) <= 0
+	case ">":
+		return x.Cmp(y) > 0
+	case ">=":
+		return x.Cmp(y) >= 0
+	case "==":
+		return x.Cmp(y) == 0
+	case "!=":
+		return x.Cmp(y) != 0
+	case "&&":
+		return x.Sign() != 0 && y.Sign() != 0
+	case "||":
+		return x.Sign() != 0 || y.Sign() != 0
+	default: // models.Not
+		return x.Sign() == 0
+	}
+}
+
+func boolRat(b bool) *big.Rat {
+	if b {
+		return big.NewRat(1, 1)
+	}
+	return new(big.Rat)
+}
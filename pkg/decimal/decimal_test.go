@@ -0,0 +1,221 @@
+package decimal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"calculator/pkg/models"
+)
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		value    string
+		scale    int
+		rounding Rounding
+		expected string
+	}{
+		{"2.5", 0, HalfEven, "2"},
+		{"3.5", 0, HalfEven, "4"},
+		{"-2.5", 0, HalfEven, "-2"},
+		{"2.5", 0, HalfUp, "3"},
+		{"-2.5", 0, HalfUp, "-3"},
+		{"2.5", 0, HalfDown, "2"},
+		{"2.51", 0, HalfDown, "3"},
+		{"2.1", 0, Up, "3"},
+		{"-2.1", 0, Up, "-3"},
+		{"2.9", 0, Down, "2"},
+		{"-2.9", 0, Down, "-2"},
+		{"-2.1", 0, Ceiling, "-2"},
+		{"2.1", 0, Ceiling, "3"},
+		{"-2.1", 0, Floor, "-3"},
+		{"1.005", 2, HalfUp, "1.01"}, // в float64 здесь было бы 1.00
+		{"0.000001", 3, HalfEven, "0"},
+		{"-0.0001", 2, HalfEven, "0"},
+		{"1e-9", 20, HalfEven, "0.000000001"},
+		{"120.500", 5, HalfEven, "120.5"},
+	}
+
+	for _, tt := range tests {
+		x, err := Parse(tt.value)
+		if err != nil {
+			t.Fatalf("Parse(%s) error: %v", tt.value, err)
+		}
+		c := Context{Scale: tt.scale, Rounding: tt.rounding}
+		if got := c.Format(x); got != tt.expected {
+			t.Errorf("Format(%s, %d, %s) = %s, expected %s", tt.value, tt.scale, tt.rounding, got, tt.expected)
+		}
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	c := Context{Scale: DefaultScale, Rounding: DefaultRounding}
+	tests := []struct {
+		operator string
+		a        string
+		b        string
+		expected string
+		err      bool
+	}{
+		{"+", "0.1", "0.2", "0.3", false},
+		{"-", "1", "0.9", "0.1", false},
+		{"*", "1.1", "1.1", "1.21", false},
+		{"/", "1", "3", "0.33333333333333333333", false},
+		{"/", "2", "3", "0.66666666666666666667", false},
+		{"/", "1", "0", "", true},
+		{"//", "-7", "2", "-4", false},
+		{"%", "-7", "3", "2", false},
+		{"%", "5.5", "2", "1.5", false},
+		{"^", "1.1", "2", "1.21", false},
+		{"^", "2", "-2", "0.25", false},
+		{"^", "2", "0.5", "", true},
+		{"^", "0", "-1", "", true},
+		{"!", "25", "", "15511210043330985984000000", false},
+		{"!", "-1", "", "", true},
+		{"^", "1e10000", "10000", "", true},
+		{"^", "1e-200", "-10000", "", true},
+		{"*", "1e200000", "1e200000", "", true},
+		{models.Negation, "0.1", "", "-0.1", false},
+		{"==", "0.3", "0.30", "1", false},
+		{"<", "0.1", "0.2", "1", false},
+		{"&&", "1", "0", "0", false},
+		{models.Not, "0", "", "1", false},
+		{"+", "1e20", "1", "100000000000000000001", false},
+		{"+", "1.2.3", "1", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := c.Calculate(tt.operator, tt.a, tt.b)
+		if (err != nil) != tt.err {
+			t.Fatalf("Calculate(%s, %s, %s) error = %v, wantErr %v", tt.operator, tt.a, tt.b, err, tt.err)
+		}
+		if got != tt.expected {
+			t.Errorf("Calculate(%s, %s, %s) = %s, expected %s", tt.operator, tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	c := Context{Scale: 10, Rounding: HalfEven}
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+		err      error
+	}{
+		{"sqrt", []string{"2"}, "1.4142135624", nil},
+		{"sqrt", []string{"0.25"}, "0.5", nil},
+		{"sqrt", []string{"-1"}, "", models.ErrDomain},
+		{"round", []string{"2.5"}, "3", nil},
+		{"round", []string{"1.005", "2"}, "1.01", nil},
+		{"round", []string{"1250", "-2"}, "1300", nil},
+		{"floor", []string{"-1.5"}, "-2", nil},
+		{"ceil", []string{"-1.5"}, "-1", nil},
+		{"abs", []string{"-0.1"}, "0.1", nil},
+		{"min", []string{"0.3", "0.1", "0.2"}, "0.1", nil},
+		{"max", []string{"0.3", "0.1", "0.2"}, "0.3", nil},
+		{"round", []string{"1", "2", "3"}, "", models.ErrArgumentsCount},
+	}
+
+	for _, tt := range tests {
+		got, err := c.Call(tt.name, tt.args)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("Call(%s, %v) error = %v, expected %v", tt.name, tt.args, err, tt.err)
+		}
+		if got != tt.expected {
+			t.Errorf("Call(%s, %v) = %s, expected %s", tt.name, tt.args, got, tt.expected)
+		}
+	}
+
+	if _, err := c.Call("sin", []string{"1"}); err == nil {
+		t.Error("Call(sin) expected error in decimal mode")
+	}
+}
+
+func TestRational(t *testing.T) {
+	c := Rational()
+	tests := []struct {
+		operator string
+		a        string
+		b        string
+		expected string
+		err      bool
+	}{
+		{"+", "1/3", "1/6", "1/2", false},
+		{"/", "1", "3", "1/3", false},
+		{"*", "2/3", "3/2", "1", false},
+		{"-", "0.1", "1/10", "0", false},
+		{"+", "0.1", "0.2", "3/10", false},
+		{"//", "7/2", "1", "3", false},
+		{"%", "-7/2", "1", "1/2", false},
+		{"^", "2/3", "-2", "9/4", false},
+		{"^", "2", "1/2", "", true},
+		{"/", "1/3", "0", "", true},
+		{models.Negation, "1/3", "", "-1/3", false},
+		{"==", "2/4", "0.5", "1", false},
+	}
+
+	for _, tt := range tests {
+		got, err := c.Calculate(tt.operator, tt.a, tt.b)
+		if (err != nil) != tt.err {
+			t.Fatalf("Calculate(%s, %s, %s) error = %v, wantErr %v", tt.operator, tt.a, tt.b, err, tt.err)
+		}
+		if got != tt.expected {
+			t.Errorf("Calculate(%s, %s, %s) = %s, expected %s", tt.operator, tt.a, tt.b, got, tt.expected)
+		}
+	}
+
+	calls := []struct {
+		name     string
+		args     []string
+		expected string
+		err      bool
+	}{
+		{"sqrt", []string{"9/4"}, "3/2", false},
+		{"sqrt", []string{"2"}, "", true},
+		{"floor", []string{"-1/3"}, "-1", false},
+		{"max", []string{"1/3", "0.3"}, "1/3", false},
+		{"sin", []string{"1"}, "", true},
+	}
+
+	for _, tt := range calls {
+		got, err := c.Call(tt.name, tt.args)
+		if (err != nil) != tt.err {
+			t.Fatalf("Call(%s, %v) error = %v, wantErr %v", tt.name, tt.args, err, tt.err)
+		}
+		if got != tt.expected {
+			t.Errorf("Call(%s, %v) = %s, expected %s", tt.name, tt.args, got, tt.expected)
+		}
+	}
+}
+
+func TestApprox(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected float64
+	}{
+		{"1/2", 0.5},
+		{"0.3", 0.3},
+		{"-1/3", -1.0 / 3},
+		{"1" + strings.Repeat("0", 400), 0}, // вне диапазона float64
+		{"abc", 0},
+	}
+
+	for _, tt := range tests {
+		if got := Approx(tt.value); got != tt.expected {
+			t.Errorf("Approx(%.20s) = %v, expected %v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	if c, err := NewContext(DefaultScale, ""); err != nil || c.Rounding != DefaultRounding {
+		t.Errorf("NewContext(20, \"\") = %v, %v", c, err)
+	}
+	if _, err := NewContext(-1, ""); !errors.Is(err, ErrScale) {
+		t.Errorf("NewContext(-1) error = %v, expected %v", err, ErrScale)
+	}
+	if _, err := NewContext(2, "banker"); !errors.Is(err, ErrUnknownRounding) {
+		t.Errorf("NewContext(banker) error = %v, expected %v", err, ErrUnknownRounding)
+	}
+}
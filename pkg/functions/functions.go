@@ -0,0 +1,147 @@
+package functions
+
+// реестр встроенных функций: парсер проверяет по нему имя и число аргументов,
+// агент - вычисляет значение
+
+import (
+	"fmt"
+	"math"
+
+	"calculator/pkg/models"
+)
+
+// Function описывает встроенную функцию
+// MaxArgs < 0 - число аргументов не ограничено сверху
+type Function struct {
+	MinArgs int
+	MaxArgs int
+	call    func(args []float64) (float64, error)
+}
+
+var registry = map[string]Function{
+	"sqrt": unary(func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, domainErr("sqrt", "argument must be non-negative", x)
+		}
+		return math.Sqrt(x), nil
+	}),
+	"sin": unary(plain(math.Sin)),
+	"cos": unary(plain(math.Cos)),
+	"tan": unary(plain(math.Tan)),
+	"ln": unary(func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, domainErr("ln", "argument must be positive", x)
+		}
+		return math.Log(x), nil
+	}),
+	"log10": unary(func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, domainErr("log10", "argument must be positive", x)
+		}
+		return math.Log10(x), nil
+	}),
+	"exp":   unary(plain(math.Exp)),
+	"abs":   unary(plain(math.Abs)),
+	"floor": unary(plain(math.Floor)),
+	"ceil":  unary(plain(math.Ceil)),
+	"round": {MinArgs: 1, MaxArgs: 2, call: round},
+	"min":   {MinArgs: 1, MaxArgs: -1, call: minimum},
+	"max":   {MinArgs: 1, MaxArgs: -1, call: maximum},
+}
+
+// Lookup возвращает функцию по имени
+func Lookup(name string) (Function, bool) {
+	f, ok := registry[name]
+	return f, ok
+}
+
+// CheckArity проверяет, что функция name принимает n аргументов
+func CheckArity(name string, n int) error {
+	f, ok := Lookup(name)
+	if !ok {
+		return fmt.Errorf("%w: %s", models.ErrUnknownFunction, name)
+	}
+
+	if n < f.MinArgs || (f.MaxArgs >= 0 && n > f.MaxArgs) {
+		return fmt.Errorf("%w: %s expects %s, got %d", models.ErrArgumentsCount, name, f.arity(), n)
+	}
+	return nil
+}
+
+// Call вычисляет функцию name от аргументов args
+func Call(name string, args []float64) (float64, error) {
+	if err := CheckArity(name, len(args)); err != nil {
+		return 0, err
+	}
+
+	result, err := registry[name].call(args)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return 0, fmt.Errorf("%w: %s result is out of range", models.ErrDomain, name)
+	}
+	return result, nil
+}
+
+func (f Function) arity() string {
+	switch {
+	case f.MaxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", f.MinArgs)
+	case f.MinArgs == f.MaxArgs:
+		return fmt.Sprintf("%d argument(s)", f.MinArgs)
+	default:
+		return fmt.Sprintf("%d to %d arguments", f.MinArgs, f.MaxArgs)
+	}
+}
+
+func unary(f func(x float64) (float64, error)) Function {
+	return Function{
+		MinArgs: 1,
+		MaxArgs: 1,
+		call: func(args []float64) (float64, error) {
+			return f(args[0])
+		},
+	}
+}
+
+func plain(f func(x float64) float64) func(x float64) (float64, error) {
+	return func(x float64) (float64, error) {
+		return f(x), nil
+	}
+}
+
+func domainErr(name, msg string, x float64) error {
+	return fmt.Errorf("%w: %s: %s, got %g", models.ErrDomain, name, msg, x)
+}
+
+// round(x) округляет до целого, round(x, n) - до n знаков после запятой
+func round(args []float64) (float64, error) {
+	if len(args) == 1 {
+		return math.Round(args[0]), nil
+	}
+
+	digits := args[1]
+	if digits != math.Trunc(digits) {
+		return 0, domainErr("round", "number of digits must be an integer", digits)
+	}
+
+	scale := math.Pow(10, digits)
+	return math.Round(args[0]*scale) / scale, nil
+}
+
+func minimum(args []float64) (float64, error) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = math.Min(result, arg)
+	}
+	return result, nil
+}
+
+func maximum(args []float64) (float64, error) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		result = math.Max(result, arg)
+	}
+	return result, nil
+}
@@ -0,0 +1,64 @@
+package functions
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"calculator/pkg/models"
+)
+
+func TestCall(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []float64
+		expected float64
+		err      error
+	}{
+		{"sqrt", []float64{16}, 4, nil},
+		{"sqrt", []float64{-1}, 0, models.ErrDomain},
+		{"sin", []float64{0}, 0, nil},
+		{"cos", []float64{0}, 1, nil},
+		{"ln", []float64{math.E}, 1, nil},
+		{"ln", []float64{0}, 0, models.ErrDomain},
+		{"log10", []float64{1000}, 3, nil},
+		{"exp", []float64{0}, 1, nil},
+		{"exp", []float64{1000}, 0, models.ErrDomain},
+		{"abs", []float64{-2.5}, 2.5, nil},
+		{"floor", []float64{-2.5}, -3, nil},
+		{"ceil", []float64{2.1}, 3, nil},
+		{"round", []float64{2.5}, 3, nil},
+		{"round", []float64{3.14159, 2}, 3.14, nil},
+		{"round", []float64{3.14159, 0.5}, 0, models.ErrDomain},
+		{"min", []float64{3, -1, 2}, -1, nil},
+		{"max", []float64{3, -1, 2}, 3, nil},
+		{"max", nil, 0, models.ErrArgumentsCount},
+		{"sqrt", []float64{1, 2}, 0, models.ErrArgumentsCount},
+		{"foo", []float64{1}, 0, models.ErrUnknownFunction},
+	}
+
+	for _, tt := range tests {
+		result, err := Call(tt.name, tt.args)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Call(%s, %v) error = %v, expected %v", tt.name, tt.args, err, tt.err)
+		}
+		if math.Abs(result-tt.expected) > 1e-9 {
+			t.Errorf("Call(%s, %v) = %v, expected %v", tt.name, tt.args, result, tt.expected)
+		}
+	}
+}
+
+func TestCheckArity(t *testing.T) {
+	if err := CheckArity("round", 2); err != nil {
+		t.Errorf("CheckArity(round, 2) = %v, expected nil", err)
+	}
+
+	err := CheckArity("round", 3)
+	if !errors.Is(err, models.ErrArgumentsCount) {
+		t.Fatalf("CheckArity(round, 3) = %v, expected %v", err, models.ErrArgumentsCount)
+	}
+	expected := "wrong number of arguments: round expects 1 to 2 arguments, got 3"
+	if err.Error() != expected {
+		t.Errorf("CheckArity(round, 3) = %q, expected %q", err.Error(), expected)
+	}
+}
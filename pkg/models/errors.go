@@ -2,6 +2,9 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
 )
 
 var (
@@ -18,11 +21,118 @@ var (
 	ErrDivisionByZero    = errors.New("division by zero")
 	ErrUnknownOperator   = errors.New("unknown operator")
 	ErrEmptyStack        = errors.New("stack is empty")
+	ErrUnknownFunction   = errors.New("unknown function")
+	ErrUnboundVariable   = errors.New("unbound variable")
+	ErrArgumentsCount    = errors.New("wrong number of arguments")
+	ErrMisplacedComma    = errors.New("comma outside of function arguments")
+	ErrDomain            = errors.New("argument is out of the function domain")
+	ErrMalformedNumber   = errors.New("malformed number")
+	ErrUnknownSyntax     = errors.New("unknown syntax")
+	ErrUnbalancedTernary = errors.New("conditional operator without matching ? or :")
+	ErrCancelled         = errors.New("expression was cancelled")
+	ErrTimeout           = errors.New("evaluation timed out")
 )
 
+// UnboundVariableError - в выражении есть имя, для которого не передано значение
+type UnboundVariableError struct {
+	Name string
+}
+
+func (e *UnboundVariableError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrUnboundVariable, e.Name)
+}
+
+func (e *UnboundVariableError) Unwrap() error {
+	return ErrUnboundVariable
+}
+
+// ParseError - ошибка разбора выражения с указанием места
+// Err - одна из ошибок выше, поэтому errors.Is(err, ErrMergedOperators) продолжает работать
+type ParseError struct {
+	Err      error  // причина ошибки
+	Position int    // смещение в байтах от начала выражения
+	Length   int    // длина ошибочного фрагмента в байтах
+	Token    string // ошибочный фрагмент
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v at position %d", e.Err, e.Position)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// коды ошибок разбора для клиентов API
+var parseErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{ErrOperatorFirst, "operator_first"},
+	{ErrOperatorLast, "operator_last"},
+	{ErrEmptyBrackets, "empty_brackets"},
+	{ErrMergedBrackets, "merged_brackets"},
+	{ErrMergedOperators, "merged_operators"},
+	{ErrWrongCharacter, "wrong_character"},
+	{ErrInvalidExpression, "invalid_expression"},
+	{ErrNotOpenedBracket, "not_opened_bracket"},
+	{ErrNotClosedBracket, "not_closed_bracket"},
+	{ErrNoOperators, "no_operands"},
+	{ErrDivisionByZero, "division_by_zero"},
+	{ErrUnknownOperator, "unknown_operator"},
+	{ErrUnknownFunction, "unknown_function"},
+	{ErrUnboundVariable, "unbound_variable"},
+	{ErrArgumentsCount, "arguments_count"},
+	{ErrMisplacedComma, "misplaced_comma"},
+	{ErrMalformedNumber, "malformed_number"},
+	{ErrUnbalancedTernary, "unbalanced_conditional"},
+}
+
+// Code возвращает машиночитаемый код ошибки
+func (e *ParseError) Code() string {
+	for _, c := range parseErrorCodes {
+		if errors.Is(e.Err, c.err) {
+			return c.code
+		}
+	}
+	return "parse_error"
+}
+
+// Snippet рисует выражение и каретки под ошибочным фрагментом:
+//
+//	2+*3
+//	  ^
+func (e *ParseError) Snippet(expression string) string {
+	pos := min(max(e.Position, 0), len(expression))
+	width := max(e.Length, 1)
+	if pos+e.Length <= len(expression) {
+		width = max(utf8.RuneCountInString(expression[pos:pos+e.Length]), 1)
+	}
+
+	return expression + "\n" + strings.Repeat(" ", utf8.RuneCountInString(expression[:pos])) + strings.Repeat("^", width)
+}
+
+const (
+	Operator      = "operator"
+	UnaryOperator = "unary operator"
+	Operand       = "operand"
+	OpenBracket   = "open bracket"
+	CloseBracket  = "close bracket"
+	Function      = "function"
+	Identifier    = "identifier"
+	Comma         = "comma"
+	Postfix       = "postfix operator"
+)
+
+// унарный минус, в дереве это узел с одним листом (Left)
+const Negation = "neg"
+
+// логическое отрицание, тоже узел с одним листом
+const Not = "not"
+
+// условие: cond ? a : b и if(cond, a, b) дают один и тот же узел
+// с AstType Conditional и аргументами [cond, a, b]
 const (
-	Operator     = "operator"
-	Operand      = "operand"
-	OpenBracket  = "open bracket"
-	CloseBracket = "close bracket"
+	Ternary     = "?:"
+	Conditional = "if"
 )
@@ -1,21 +1,81 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// статусы выражения в таблице expressions
+const (
+	StatusPending    = "pending"
+	StatusProcessing = "processing"
+	StatusDone       = "done"
+	StatusError      = "error"
+	StatusCancelled  = "cancelled" // выражение отменено пользователем
+	StatusTimeout    = "timeout"   // выражение не посчитано к сроку
+)
+
+// статусы задачи в таблице tasks
+const (
+	TaskQueued  = "queued"  // узел готов, задача ждет агента
+	TaskRunning = "running" // задача отдана агенту
+	TaskDone    = "done"
+	TaskError   = "error"
+)
+
+// классы приоритета: задачи interactive всегда отправляются агентам раньше задач batch
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+// режимы чисел: в точных режимах значения узлов и результаты - точные строки
+const (
+	ModeFloat    = "float"
+	ModeDecimal  = "decimal"
+	ModeRational = "rational"
+)
+
 type (
 	AstNode struct {
-		ID       int      `json:"id"`
-		AstType  string   `json:"type"`
-		Value    string   `json:"operation"`
-		Left     *AstNode `json:"arg1"`
-		Right    *AstNode `json:"arg2"`
-		Counting bool     `json:"status"`
+		ID       int        `json:"id"`
+		AstType  string     `json:"type"`
+		Value    string     `json:"operation"`
+		Left     *AstNode   `json:"arg1"`
+		Right    *AstNode   `json:"arg2"`
+		Args     []*AstNode `json:"args,omitempty"` // аргументы вызова функции
+		Counting bool       `json:"status"`
 	}
 
 	Expression struct {
 		ID         int     `json:"id"`
 		UserID     int     `json:"user_id"`
 		Expression string  `json:"expression"`
+		Normalized string  `json:"normalized,omitempty"` // каноническая запись: как сервер понял выражение
 		Status     string  `json:"status"`
 		Result     float64 `json:"result"`
+		CreatedAt  string  `json:"created_at"`
+		FinishedAt string  `json:"finished_at"`
+		Error      string  `json:"error,omitempty"`
+		Exact      string  `json:"-"` // точный результат, только в точных режимах: 0.3, 1/2
+	}
+
+	// Precision - режим чисел выражения; Scale и Rounding нужны только режиму decimal
+	Precision struct {
+		Mode     string
+		Scale    int
+		Rounding string
+	}
+
+	// ExpressionState - сохраненное состояние выражения, по которому оно досчитывается после перезапуска
+	ExpressionState struct {
+		ID        int
+		Tree      []byte // дерево после оптимизатора в JSON, nil - выражение сохранено без состояния
+		Precision Precision
+		NoCache   bool
+		Deadline  time.Time // срок вычисления, нулевой - срока нет
+		UserID    int       // чья очередь в планировщике
+		Priority  string
 	}
 
 	User struct {
@@ -25,8 +85,24 @@ type (
 	}
 
 	Result struct {
-		ID     int     `json:"id"`
-		Result float64 `json:"result"`
-		Error  string  `json:"error"`
+		ID           int     `json:"id"`
+		ExpressionID int     `json:"expression_id"`
+		Result       float64 `json:"result"`
+		Value        string  `json:"value,omitempty"` // точное значение в точных режимах
+		Error        string  `json:"error"`
 	}
 )
+
+// MarshalJSON: в точных режимах result - точная строка, а approx - ее приближение
+func (e Expression) MarshalJSON() ([]byte, error) {
+	type plain Expression
+	if e.Exact == "" {
+		return json.Marshal(plain(e))
+	}
+
+	return json.Marshal(struct {
+		plain
+		Result string  `json:"result"`
+		Approx float64 `json:"approx"`
+	}{plain(e), e.Exact, e.Result})
+}
@@ -0,0 +1,268 @@
+package optimizer
+
+// оптимизация дерева перед отправкой агентам:
+// свертка констант, алгебраические тождества и объединение одинаковых поддеревьев
+// константы сворачиваются теми же операторами, что у агента, поэтому результат выражения не меняется
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"calculator/pkg/calculator"
+	"calculator/pkg/decimal"
+	"calculator/pkg/models"
+)
+
+// Fold - какие узлы с известными операндами оркестратор считает сам, не отправляя агентам
+type Fold string
+
+const (
+	FoldNone  Fold = "none"  // все считают агенты
+	FoldCheap Fold = "cheap" // арифметика без ^ и !, сравнения и логика
+	FoldAll   Fold = "all"   // все операторы и функции
+)
+
+var ErrUnknownFold = errors.New("unknown fold policy")
+
+// ParseFold проверяет название политики свертки, пустое название - FoldCheap
+func ParseFold(name string) (Fold, error) {
+	switch fold := Fold(name); fold {
+	case "":
+		return FoldCheap, nil
+	case FoldNone, FoldCheap, FoldAll:
+		return fold, nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownFold, name)
+	}
+}
+
+// Policy - какие оптимизации применять
+type Policy struct {
+	Fold       Fold
+	Identities bool // x*0 = 0 для литерала x, x+0 = x, x-0 = x, x*1 = x, x/1 = x
+	Dedupe     bool // одинаковые поддеревья считаются один раз
+}
+
+// DefaultPolicy - политика по умолчанию
+var DefaultPolicy = Policy{Fold: FoldCheap, Identities: true, Dedupe: true}
+
+// дешевые операторы для FoldCheap
+var cheap = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true, "//": true, "%": true, models.Negation: true,
+	"<": true, "<=": true, ">": true, ">=": true, "==": true, "!=": true, "&&": true, "||": true, models.Not: true,
+}
+
+// Optimize упрощает дерево и возвращает новый корень; узлы исходного дерева переиспользуются
+// после объединения поддеревьев дерево становится DAG: один узел может быть листом нескольких
+func Optimize(root *models.AstNode, policy Policy, precision models.Precision) *models.AstNode {
+	o := optimizer{policy: policy, precision: precision}
+	root = o.simplify(root)
+	if policy.Dedupe {
+		root, _ = dedupe(root, make(map[string]*models.AstNode))
+	}
+	return root
+}
+
+type optimizer struct {
+	policy    Policy
+	precision models.Precision
+}
+
+func (o optimizer) simplify(node *models.AstNode) *models.AstNode {
+	switch node.AstType {
+	case "number":
+		return node
+
+	// известное условие заменяет узел выбранной ветвью, как это делает оркестратор
+	case "conditional":
+		node.Args[0] = o.simplify(node.Args[0])
+		if o.policy.Fold != FoldNone && node.Args[0].AstType == "number" {
+			if calculator.Truthy(node.Args[0].Value) {
+				return o.simplify(node.Args[1])
+			}
+			return o.simplify(node.Args[2])
+		}
+		node.Args[1] = o.simplify(node.Args[1])
+		node.Args[2] = o.simplify(node.Args[2])
+		return node
+
+	case "function":
+		for i, arg := range node.Args {
+			node.Args[i] = o.simplify(arg)
+		}
+		if o.folds(node) && leaves(node) {
+			return o.fold(node)
+		}
+		return node
+	}
+
+	node.Left = o.simplify(node.Left)
+
+	// левый операнд уже решает результат: 0 && x = 0, 1 || x = 1
+	lazy := node.Value == "&&" || node.Value == "||"
+	if lazy && o.policy.Fold != FoldNone && node.Left.AstType == "number" &&
+		calculator.Truthy(node.Left.Value) == (node.Value == "||") {
+		return o.fold(node)
+	}
+
+	if node.Right != nil {
+		node.Right = o.simplify(node.Right)
+	}
+	if o.folds(node) && leaves(node) {
+		return o.fold(node)
+	}
+	if o.policy.Identities {
+		return o.identity(node)
+	}
+	return node
+}
+
+// folds - сворачивает ли политика узел, когда его листья известны
+func (o optimizer) folds(node *models.AstNode) bool {
+	switch o.policy.Fold {
+	case FoldAll:
+		return true
+	case FoldCheap:
+		return node.AstType == "operation" && cheap[node.Value]
+	default:
+		return false
+	}
+}
+
+// leaves - все ли листья узла - числа
+func leaves(node *models.AstNode) bool {
+	children := node.Args
+	if node.AstType != "function" {
+		children = []*models.AstNode{node.Left}
+		if node.Right != nil {
+			children = append(children, node.Right)
+		}
+	}
+
+	for _, child := range children {
+		if child.AstType != "number" {
+			return false
+		}
+	}
+	return true
+}
+
+// fold заменяет узел его значением
+// узел с ошибкой (деление на ноль, выход из области определения) остается агенту,
+// чтобы выражение завершилось с той же ошибкой, что и без оптимизации
+func (o optimizer) fold(node *models.AstNode) *models.AstNode {
+	value, err := calculator.Fold(node, o.precision)
+	if err != nil {
+		return node
+	}
+	return number(node.ID, value)
+}
+
+func (o optimizer) identity(node *models.AstNode) *models.AstNode {
+	left, right := node.Left, node.Right
+	if right == nil {
+		return node
+	}
+
+	switch node.Value {
+	case "*":
+		// второй операнд выбрасывается, поэтому он должен быть литералом:
+		// sqrt(-1)*0 и (1/(1-1))*0 - ошибки, а не 0
+		if (constant(left, 0) && right.AstType == "number") || (constant(right, 0) && left.AstType == "number") {
+			return number(node.ID, "0")
+		}
+		if constant(right, 1) {
+			return o.keep(node, left)
+		}
+		if constant(left, 1) {
+			return o.keep(node, right)
+		}
+	case "+":
+		if constant(right, 0) {
+			return o.keep(node, left)
+		}
+		if constant(left, 0) {
+			return o.keep(node, right)
+		}
+	case "-":
+		if constant(right, 0) {
+			return o.keep(node, left)
+		}
+	case "/":
+		if constant(right, 1) {
+			return o.keep(node, left)
+		}
+	}
+	return node
+}
+
+// keep заменяет узел операндом x
+// в режиме decimal результат операции округляется, поэтому операндом можно заменить,
+// только если он сам - результат операции, а не литерал или ветвь условия
+func (o optimizer) keep(node, x *models.AstNode) *models.AstNode {
+	if o.precision.Mode == models.ModeDecimal && x.AstType != "operation" && x.AstType != "function" {
+		return node
+	}
+	return x
+}
+
+// constant - является ли узел числом, равным v: 0, 0.0, 1.00
+func constant(node *models.AstNode, v int64) bool {
+	if node.AstType != "number" {
+		return false
+	}
+	x, err := decimal.Parse(node.Value)
+	return err == nil && x.Cmp(big.NewRat(v, 1)) == 0
+}
+
+func number(id int, value string) *models.AstNode {
+	return &models.AstNode{ID: id, AstType: "number", Value: value}
+}
+
+// dedupe заменяет одинаковые поддеревья одним узлом и возвращает ключ поддерева
+// ленивые части (ветви условия, правый операнд && и ||) получают свою область:
+// оркестратор забывает невычисленную ветвь целиком, и общий с ней узел остался бы без задачи
+func dedupe(node *models.AstNode, scope map[string]*models.AstNode) (*models.AstNode, string) {
+	if node.AstType == "number" {
+		return node, node.Value
+	}
+
+	var keys []string
+	switch {
+	case node.AstType == "conditional":
+		var key string
+		node.Args[0], key = dedupe(node.Args[0], scope)
+		keys = append(keys, key)
+		for i := 1; i < len(node.Args); i++ {
+			node.Args[i], key = dedupe(node.Args[i], make(map[string]*models.AstNode))
+			keys = append(keys, key)
+		}
+	case node.AstType == "function":
+		for i, arg := range node.Args {
+			var key string
+			node.Args[i], key = dedupe(arg, scope)
+			keys = append(keys, key)
+		}
+	default:
+		var key string
+		node.Left, key = dedupe(node.Left, scope)
+		keys = append(keys, key)
+		if node.Right != nil {
+			right := scope
+			if node.Value == "&&" || node.Value == "||" {
+				right = make(map[string]*models.AstNode)
+			}
+			node.Right, key = dedupe(node.Right, right)
+			keys = append(keys, key)
+		}
+	}
+
+	key := node.AstType + ":" + node.Value + "(" + strings.Join(keys, ",") + ")"
+	if same, ok := scope[key]; ok {
+		return same, key
+	}
+	scope[key] = node
+	return node, key
+}
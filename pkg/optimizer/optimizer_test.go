@@ -0,0 +1,211 @@
+package optimizer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"calculator/pkg/ast"
+	"calculator/pkg/calculator"
+	"calculator/pkg/models"
+)
+
+// sexpr записывает дерево в виде (оператор аргументы...)
+func sexpr(node *models.AstNode) string {
+	switch node.AstType {
+	case "number":
+		return node.Value
+	case "function", "conditional":
+		args := make([]string, len(node.Args))
+		for i, arg := range node.Args {
+			args[i] = sexpr(arg)
+		}
+		return "(" + node.Value + " " + strings.Join(args, " ") + ")"
+	}
+
+	if node.Right == nil {
+		return "(" + node.Value + " " + sexpr(node.Left) + ")"
+	}
+	return "(" + node.Value + " " + sexpr(node.Left) + " " + sexpr(node.Right) + ")"
+}
+
+var (
+	floatMode = models.Precision{Mode: models.ModeFloat}
+	decimal2  = models.Precision{Mode: models.ModeDecimal, Scale: 2, Rounding: "half_even"}
+	rational  = models.Precision{Mode: models.ModeRational}
+	noFold    = Policy{Fold: FoldNone}
+	foldCheap = Policy{Fold: FoldCheap}
+	foldAll   = Policy{Fold: FoldAll}
+	withIds   = Policy{Fold: FoldCheap, Identities: true}
+)
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		expression string
+		policy     Policy
+		precision  models.Precision
+		expected   string
+	}{
+		{"2+3*4", noFold, floatMode, "(+ 2 (* 3 4))"},
+		{"2+3*4", foldCheap, floatMode, "14"},
+		{"2^10+sqrt(16)", foldCheap, floatMode, "(+ (^ 2 10) (sqrt 16))"},
+		{"2^10+sqrt(16)", foldAll, floatMode, "1028"},
+		{"sqrt(2)+1*3", foldCheap, floatMode, "(+ (sqrt 2) 3)"},
+		{"0.1+0.2", foldCheap, floatMode, "0.30000000000000004"},
+		{"0.1+0.2", foldCheap, rational, "3/10"},
+		{"2/3", foldCheap, decimal2, "0.67"},
+		// ошибку при свертке вернет агент
+		{"1/(2-2)", foldCheap, floatMode, "(/ 1 0)"},
+		{"sqrt(0-1)", foldAll, floatMode, "(sqrt -1)"},
+		// известное условие оставляет только выбранную ветвь
+		{"3>2 ? sqrt(2) : 1/(1-1)", foldCheap, floatMode, "(sqrt 2)"},
+		{"if(0, 1/(1-1), sqrt(2))", foldCheap, floatMode, "(sqrt 2)"},
+		{"sqrt(2)>1 ? 1 : 2", foldCheap, floatMode, "(if (> (sqrt 2) 1) 1 2)"},
+		{"0 && sqrt(2)", foldCheap, floatMode, "0"},
+		{"2 || sqrt(2)", foldCheap, floatMode, "1"},
+		{"1 && sqrt(2)", foldCheap, floatMode, "(&& 1 (sqrt 2))"},
+		{"0 && sqrt(2)", noFold, floatMode, "(&& 0 (sqrt 2))"},
+		// тождества
+		{"sqrt(2)*1", withIds, floatMode, "(sqrt 2)"},
+		{"1*sqrt(2)+0", withIds, floatMode, "(sqrt 2)"},
+		{"sqrt(2)-0.0", withIds, floatMode, "(sqrt 2)"},
+		{"sqrt(2)/1", withIds, floatMode, "(sqrt 2)"},
+		{"0*(sqrt(2)^3!)", withIds, floatMode, "(* 0 (^ (sqrt 2) (! 3)))"},
+		{"sqrt(2)^3!*0", withIds, floatMode, "(* (^ (sqrt 2) (! 3)) 0)"},
+		{"2.5*0", Policy{Fold: FoldNone, Identities: true}, floatMode, "0"},
+		// поддерево, которое может завершиться ошибкой, не выбрасывается
+		{"sqrt(0-1)*0", withIds, floatMode, "(* (sqrt -1) 0)"},
+		{"0*(1/(1-1))", withIds, floatMode, "(* 0 (/ 1 0))"},
+		{"0-sqrt(2)", withIds, floatMode, "(- 0 (sqrt 2))"},
+		{"1/sqrt(2)", withIds, floatMode, "(/ 1 (sqrt 2))"},
+		{"sqrt(2)*1", foldCheap, floatMode, "(* (sqrt 2) 1)"},
+		// в decimal литерал без операции не округляется, поэтому тождество не применяется
+		{"0.123+0", Policy{Fold: FoldNone, Identities: true}, decimal2, "(+ 0.123 0)"},
+		{"(2^0.5)+0", Policy{Fold: FoldNone, Identities: true}, decimal2, "(^ 2 0.5)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			root, err := ast.Build(tt.expression)
+			if err != nil {
+				t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+			}
+			if got := sexpr(Optimize(root, tt.policy, tt.precision)); got != tt.expected {
+				t.Errorf("Optimize(%s) = %s, expected %s", tt.expression, got, tt.expected)
+			}
+		})
+	}
+}
+
+// operations собирает различные узлы, которые уйдут агентам
+func operations(node *models.AstNode, seen map[*models.AstNode]bool) {
+	if node == nil || node.AstType == "number" || seen[node] {
+		return
+	}
+	seen[node] = true
+	operations(node.Left, seen)
+	operations(node.Right, seen)
+	for _, arg := range node.Args {
+		operations(arg, seen)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	dedupe := Policy{Fold: FoldNone, Dedupe: true}
+	tests := []struct {
+		expression string
+		policy     Policy
+		expected   int // узлов для агентов
+	}{
+		{"(1+2)*(1+2)", dedupe, 2},
+		{"(1+2)*(1+2)", Policy{Fold: FoldNone}, 3},
+		{"sqrt(2)+sqrt(2)+sqrt(2)", dedupe, 3},
+		{"sqrt(2)^2+sqrt(2)^2", dedupe, 3},
+		{"(2+1)*(1+2)", dedupe, 3}, // операнды в другом порядке - другое поддерево
+		// ветви ленивы: их узлы не объединяются ни друг с другом, ни с остальным деревом
+		{"sqrt(2)>1 ? sqrt(3) : sqrt(3)", dedupe, 5},
+		{"sqrt(3)+(sqrt(2)>1 ? sqrt(3) : 0)", dedupe, 6},
+		{"sqrt(2)>1 && sqrt(2)>1", dedupe, 5},
+		{"(sqrt(2)>1 ? 1 : 2)*(sqrt(2)>1 ? 1 : 2)", dedupe, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			root, err := ast.Build(tt.expression)
+			if err != nil {
+				t.Fatalf("ast.Build(%s) error: %v", tt.expression, err)
+			}
+
+			seen := make(map[*models.AstNode]bool)
+			operations(Optimize(root, tt.policy, floatMode), seen)
+			if len(seen) != tt.expected {
+				t.Errorf("Optimize(%s) left %d operations, expected %d", tt.expression, len(seen), tt.expected)
+			}
+		})
+	}
+}
+
+// оптимизированное дерево считается так же, как исходное
+func TestOptimizeKeepsResult(t *testing.T) {
+	expressions := []string{
+		"2+2*2",
+		"(1+0.5)^2*2-7//2+7%4",
+		"sin(pi/6)+ln(e^2)-sqrt(2)*1",
+		"round(2.345, 2)*max(1, -2, 3.5)+0",
+		"3!^2-2*3!",
+		"!(2>=3)&&1!=2",
+		"1>2 ? 1/(1-1) : sqrt(2)+sqrt(2)",
+		"sqrt(2)>1 ? sqrt(2)*sqrt(2) : 0",
+		"(sqrt(2)+1)*(sqrt(2)+1)-(sqrt(2)+1)^2",
+		"0.1+0.2-0.3",
+		"1e20+1",
+		"2/3+1/3",
+		"1/(1-1)",
+		"sqrt(1-2)",
+		"sqrt(2)>1 ? 1/(1-1) : 0",
+		"sqrt(0-1)*0",
+		"(1/(1-1))*0",
+		"0*sqrt(2)+1",
+		"2.5*0",
+	}
+	policies := []Policy{noFold, foldCheap, foldAll, withIds, DefaultPolicy, {Fold: FoldAll, Identities: true, Dedupe: true}}
+	precisions := []models.Precision{floatMode, decimal2, rational}
+
+	for _, expression := range expressions {
+		for _, precision := range precisions {
+			want, wantErr := evaluate(t, expression, precision, nil)
+			for _, policy := range policies {
+				got, err := evaluate(t, expression, precision, &policy)
+				if fmt.Sprint(err) != fmt.Sprint(wantErr) || got != want {
+					t.Errorf("%s (%s, %+v) = %+v, %v; expected %+v, %v", expression, precision.Mode, policy, got, err, want, wantErr)
+				}
+			}
+		}
+	}
+}
+
+func evaluate(t *testing.T, expression string, precision models.Precision, policy *Policy) (calculator.Result, error) {
+	t.Helper()
+
+	root, err := ast.Build(expression)
+	if err != nil {
+		t.Fatalf("ast.Build(%s) error: %v", expression, err)
+	}
+	if policy != nil {
+		root = Optimize(root, *policy, precision)
+	}
+	return calculator.EvaluateTree(root, calculator.WithPrecision(precision))
+}
+
+func TestParseFold(t *testing.T) {
+	if fold, err := ParseFold(""); err != nil || fold != FoldCheap {
+		t.Errorf("ParseFold(\"\") = %v, %v; expected %v", fold, err, FoldCheap)
+	}
+	if fold, err := ParseFold("all"); err != nil || fold != FoldAll {
+		t.Errorf("ParseFold(all) = %v, %v; expected %v", fold, err, FoldAll)
+	}
+	if _, err := ParseFold("some"); !errors.Is(err, ErrUnknownFold) {
+		t.Errorf("ParseFold(some) error = %v, expected %v", err, ErrUnknownFold)
+	}
+}